@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+)
+
+type AccountSpec struct {
+	// Name identifies the account. It is part of the client ID, so it must be unique and should
+	// not be changed once synced, as incremental sync state is stored per client ID.
+	Name string `json:"name"`
+
+	// UserID and APIKey are the credentials of the account. They support the same references
+	// as the top-level user_id and api_key.
+	UserID string `json:"user_id"`
+	APIKey string `json:"api_key"`
+
+	// Websites is a list of websites to fetch data for using this account.
+	Websites []WebsiteSpec `json:"websites"`
+}
+
+var reAccountName = regexp.MustCompile(`^[A-Za-z\d_.-]+$`)
+
+// accountRef is an account together with the JSON path prefix of its fields.
+type accountRef struct {
+	path    string
+	account AccountSpec
+}
+
+// accountRefs returns all accounts configured in the spec. The top-level user_id, api_key and
+// websites, if set, form an unnamed account that comes first.
+func (s Spec) accountRefs() []accountRef {
+	refs := make([]accountRef, 0, len(s.Accounts)+1)
+	if s.UserID != "" || s.APIKey != "" || len(s.Websites) > 0 || len(s.Accounts) == 0 {
+		refs = append(refs, accountRef{account: AccountSpec{UserID: s.UserID, APIKey: s.APIKey, Websites: s.Websites}})
+	}
+	for i, a := range s.Accounts {
+		refs = append(refs, accountRef{path: fmt.Sprintf("accounts[%d].", i), account: a})
+	}
+	return refs
+}
+
+// AllWebsites returns the websites of all accounts.
+func (s Spec) AllWebsites() []WebsiteSpec {
+	var websites []WebsiteSpec
+	for _, ref := range s.accountRefs() {
+		websites = append(websites, ref.account.Websites...)
+	}
+	return websites
+}
+
+// account is a configured account with its own API client.
+type account struct {
+	AccountSpec
+	client *simpleanalytics.Client
+}
+
+func newAccounts(s Spec, opts ...simpleanalytics.Option) []account {
+	if s.ArchiveDir != "" {
+		opts = append([]simpleanalytics.Option{simpleanalytics.WithArchiveDir(s.ArchiveDir)}, opts...)
+	}
+	refs := s.accountRefs()
+	accounts := make([]account, 0, len(refs))
+	for _, ref := range refs {
+		accounts = append(accounts, account{
+			AccountSpec: ref.account,
+			client:      simpleanalytics.NewClient(ref.account.UserID, ref.account.APIKey, opts...),
+		})
+	}
+	return accounts
+}
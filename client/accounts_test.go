@@ -0,0 +1,67 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebsiteMultiplexAccounts(t *testing.T) {
+	s := Spec{
+		UserID:   "legacy",
+		APIKey:   "legacy",
+		Websites: []WebsiteSpec{{Hostname: "test.com"}},
+		Accounts: []AccountSpec{
+			{Name: "agency", UserID: "a", APIKey: "a", Websites: []WebsiteSpec{{Hostname: "test.com"}, {Hostname: "a.com", Tables: []string{"other"}}}},
+			{Name: "client-b", UserID: "b", APIKey: "b", Websites: []WebsiteSpec{{Hostname: "b.com"}}},
+		},
+	}
+	c := &Client{Spec: s, accounts: newAccounts(s)}
+
+	var ids []string
+	saClients := make(map[string]bool)
+	for _, meta := range WebsiteMultiplex("table")(c) {
+		wc := meta.(*Client)
+		ids = append(ids, wc.ID())
+		if wc.SAClient == nil {
+			t.Fatalf("client %s has no API client", wc.ID())
+		}
+		saClients[wc.Account] = true
+		for _, a := range c.accounts {
+			if a.Name == wc.Account && a.client != wc.SAClient {
+				t.Errorf("client %s does not use the API client of its account", wc.ID())
+			}
+		}
+	}
+	wantIDs := []string{
+		"simple-analytics:test.com",
+		"simple-analytics:agency:test.com",
+		"simple-analytics:client-b:b.com",
+	}
+	if diff := cmp.Diff(wantIDs, ids); diff != "" {
+		t.Errorf("unexpected client IDs. diff: %s", diff)
+	}
+	if len(saClients) != 3 {
+		t.Errorf("expected one API client per account, got %d", len(saClients))
+	}
+
+	var hostnames []string
+	for _, w := range s.AllWebsites() {
+		hostnames = append(hostnames, w.Hostname)
+	}
+	if diff := cmp.Diff([]string{"test.com", "test.com", "a.com", "b.com"}, hostnames); diff != "" {
+		t.Errorf("unexpected websites. diff: %s", diff)
+	}
+}
+
+func TestAccountsOnly(t *testing.T) {
+	s := Spec{
+		Accounts: []AccountSpec{{Name: "a", UserID: "a", APIKey: "a", Websites: []WebsiteSpec{{Hostname: "a.com"}}}},
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := len(s.accountRefs()); got != 1 {
+		t.Errorf("expected no top-level account if only accounts are configured, got %d accounts", got)
+	}
+}
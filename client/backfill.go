@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+type BackfillSpec struct {
+	// Account, Website and Table select what to backfill. Website and Table accept glob patterns
+	// as supported by path.Match. Empty values select all accounts, websites or tables.
+	Account string `json:"account"`
+	Website string `json:"website"`
+	Table   string `json:"table"`
+
+	// StartDateStr and EndDateStr are the window to sync, accepting the same values as the top-level
+	// start_date and end_date, which they default to.
+	StartDateStr string `json:"start"`
+	EndDateStr   string `json:"end"`
+
+	// KeepCursor leaves the stored cursor untouched after the backfill. Backfills with a start or
+	// an end always do so unless reset_cursor is set, so it only matters for backfills of the
+	// whole date range, which otherwise save the cursor as any other sync.
+	KeepCursor bool `json:"keep_cursor"`
+}
+
+// bounded reports whether the backfill covers a window rather than the whole date range.
+func (b BackfillSpec) bounded() bool {
+	return b.StartDateStr != "" || b.EndDateStr != ""
+}
+
+// matches reports whether the backfill applies to the given table of the client's website.
+func (b BackfillSpec) matches(c *Client, table string) bool {
+	if b.Account != "" && b.Account != c.Account {
+		return false
+	}
+	if b.Website != "" {
+		if ok, _ := path.Match(strings.ToLower(b.Website), strings.ToLower(c.Website.Hostname)); !ok {
+			return false
+		}
+	}
+	if b.Table != "" {
+		if ok, _ := path.Match(b.Table, table); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// backfill returns the backfill that applies to the given table, or nil if the table is synced
+// incrementally. If reset_cursor is set, every table is backfilled from the start date.
+func (c *Client) backfill(table string) *BackfillSpec {
+	for i := range c.Spec.Backfill {
+		if c.Spec.Backfill[i].matches(c, table) {
+			return &c.Spec.Backfill[i]
+		}
+	}
+	if c.Spec.ResetCursor {
+		return &BackfillSpec{}
+	}
+	return nil
+}
+
+// EndTime returns the time at which to stop fetching data for the given table.
+func (c *Client) EndTime(table string) time.Time {
+	if b := c.backfill(table); b != nil && b.EndDateStr != "" {
+		t, _ := parseDate(b.EndDateStr, now(), c.Spec.Location()) // any error should be caught by Validate()
+		return t
+	}
+	return c.Spec.EndTime()
+}
+
+func (s Spec) validateBackfill(errs *ValidationErrors, loc *time.Location, today time.Time) {
+	for i, b := range s.Backfill {
+		p := fmt.Sprintf("backfill[%d].", i)
+		for _, f := range []struct{ name, pattern string }{{"website", b.Website}, {"table", b.Table}} {
+			if _, err := path.Match(f.pattern, ""); err != nil {
+				errs.add(p+f.name, "see https://pkg.go.dev/path#Match for the supported syntax", "invalid %s pattern %q: %v", f.name, f.pattern, err)
+			}
+		}
+		var start, end time.Time
+		if b.StartDateStr != "" {
+			t, err := parseDate(b.StartDateStr, now(), loc)
+			if err != nil {
+				errs.add(p+"start", dateHint, "could not parse start: %v", err)
+			}
+			start = t
+		}
+		if b.EndDateStr != "" {
+			t, err := parseDate(b.EndDateStr, now(), loc)
+			if err != nil {
+				errs.add(p+"end", dateHint, "could not parse end: %v", err)
+			} else if midnight(t).After(today) {
+				errs.add(p+"end", "omit end to sync up to the top-level end_date", "end %s is in the future", t.Format(AllowedTimeLayout))
+			}
+			end = t
+		}
+		if !start.IsZero() && !end.IsZero() && start.After(end) {
+			errs.add(p+"start", "start must not be after end", "start %s is after end %s", start.Format(AllowedTimeLayout), end.Format(AllowedTimeLayout))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackfillMatches(t *testing.T) {
+	c := &Client{Account: "agency", Website: WebsiteSpec{Hostname: "Blog.Test.com"}}
+	tests := []struct {
+		name string
+		b    BackfillSpec
+		want bool
+	}{
+		{name: "everything", b: BackfillSpec{}, want: true},
+		{name: "account", b: BackfillSpec{Account: "agency"}, want: true},
+		{name: "other account", b: BackfillSpec{Account: "other"}, want: false},
+		{name: "website", b: BackfillSpec{Website: "blog.test.com"}, want: true},
+		{name: "website glob", b: BackfillSpec{Website: "*.test.com"}, want: true},
+		{name: "other website", b: BackfillSpec{Website: "test.com"}, want: false},
+		{name: "table", b: BackfillSpec{Table: "simple_analytics_page_views"}, want: true},
+		{name: "table glob", b: BackfillSpec{Website: "*.test.com", Table: "simple_analytics_*"}, want: true},
+		{name: "other table", b: BackfillSpec{Table: "simple_analytics_events"}, want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.b.matches(c, "simple_analytics_page_views"); got != tc.want {
+				t.Errorf("matches() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackfillWindow(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC) }
+	s := Spec{
+		PeriodStr: "7d",
+		Backfill: []BackfillSpec{
+			{Table: "backfilled", StartDateStr: "2019-01-01", EndDateStr: "2019-12-31"},
+			{Table: "open_ended"},
+		},
+	}
+	s.SetDefaults()
+	c := &Client{Spec: s, Website: WebsiteSpec{Hostname: "test.com"}}
+
+	if got, want := c.EndTime("backfilled"), time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("unexpected backfill end. got: %v, want: %v", got, want)
+	}
+	if got, want := c.EndTime("open_ended"), time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected the backfill end to default to end_date. got: %v, want: %v", got, want)
+	}
+	if c.backfill("incremental") != nil {
+		t.Error("expected no backfill for tables that are not selected")
+	}
+	c.Spec.ResetCursor = true
+	if c.backfill("incremental") == nil {
+		t.Error("expected reset_cursor to backfill all tables")
+	}
+}
@@ -15,23 +15,52 @@ import (
 
 type Client struct {
 	Logger   zerolog.Logger
-	SAClient *simpleanalytics.Client
+	SAClient simpleanalytics.Exporter
 	Backend  backend.Backend
 	Spec     Spec
+	Account  string
 	Website  WebsiteSpec
+
+	accounts      []account
+	fieldWarnings *fieldWarnings
+	syncRuns      *syncRuns
+	shared        *shared
+	run           *syncRun
+
+	// collectsSyncRuns is set on the client of the sync runs table that emits the runs.
+	collectsSyncRuns bool
 }
 
+// ID returns the client ID, which is used to store incremental sync state. Websites of the
+// unnamed top-level account omit the account, so that their state is kept from before accounts existed.
 func (c *Client) ID() string {
-	return strings.Join([]string{"simple-analytics", c.Website.Hostname}, ":")
+	if c.Account == "" {
+		return strings.Join([]string{"simple-analytics", c.Website.Hostname}, ":")
+	}
+	return strings.Join([]string{"simple-analytics", c.Account, c.Website.Hostname}, ":")
 }
 
-func (c *Client) withWebsite(website WebsiteSpec) *Client {
+func (c *Client) withWebsite(a account, website WebsiteSpec) *Client {
+	logger := c.Logger.With().Str("hostname", website.Hostname)
+	if a.Name != "" {
+		logger = logger.Str("account", a.Name)
+	}
+	var exporter simpleanalytics.Exporter = a.client
+	if c.Spec.Mode == ModeFiles {
+		exporter = simpleanalytics.NewFileClient(website.Files)
+	}
 	return &Client{
-		Logger:   c.Logger.With().Str("hostname", website.Hostname).Logger(),
-		SAClient: c.SAClient,
+		Logger:   logger.Logger(),
+		SAClient: exporter,
 		Backend:  c.Backend,
-		Spec:     c.Spec,
+		Spec:     c.Spec.forWebsite(website),
+		Account:  a.Name,
 		Website:  website,
+
+		accounts:      c.accounts,
+		fieldWarnings: c.fieldWarnings,
+		syncRuns:      c.syncRuns,
+		shared:        c.shared,
 	}
 }
 
@@ -40,17 +69,23 @@ func New(_ context.Context, logger zerolog.Logger, s specs.Source, opts source.O
 	if err := s.UnmarshalSpec(&pluginSpec); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal plugin spec: %w", err)
 	}
+	if err := pluginSpec.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("failed to resolve plugin spec secrets: %w", err)
+	}
 	err := pluginSpec.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to validate plugin spec: %w", err)
 	}
 	pluginSpec.SetDefaults()
 
-	saClient := simpleanalytics.NewClient(pluginSpec.UserID, pluginSpec.APIKey)
 	return &Client{
-		Logger:   logger,
-		Backend:  opts.Backend,
-		Spec:     pluginSpec,
-		SAClient: saClient,
+		Logger:  logger,
+		Backend: opts.Backend,
+		Spec:    pluginSpec,
+
+		accounts:      newAccounts(pluginSpec),
+		fieldWarnings: newFieldWarnings(),
+		syncRuns:      newSyncRuns(),
+		shared:        newShared(),
 	}, nil
 }
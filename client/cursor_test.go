@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rs/zerolog"
+)
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    *Cursor
+		wantErr bool
+	}{
+		{
+			name: "legacy date",
+			in:   "2023-01-04",
+			want: &Cursor{Version: CursorVersion, Next: "2023-01-04"},
+		},
+		{
+			name: "current version",
+			in:   `{"version":1,"next":"2023-01-04","window_start":"2023-01-01","window_end":"2023-01-05","last_added_unix":1672920000,"fingerprint":"abc","stats":{"syncs":2,"rows":3,"total_rows":7,"updated_at":"2023-01-05T10:00:00Z"}}`,
+			want: &Cursor{
+				Version:       1,
+				Next:          "2023-01-04",
+				WindowStart:   "2023-01-01",
+				WindowEnd:     "2023-01-05",
+				LastAddedUnix: 1672920000,
+				Fingerprint:   "abc",
+				Stats:         CursorStats{Syncs: 2, Rows: 3, TotalRows: 7, UpdatedAt: time.Date(2023, 1, 5, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{name: "invalid legacy date", in: "2023-01-32", wantErr: true},
+		{name: "invalid JSON", in: `{"version":1,`, wantErr: true},
+		{name: "invalid next date", in: `{"version":1,"next":"yesterday"}`, wantErr: true},
+		{name: "newer version", in: `{"version":2,"next":"2023-01-04"}`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseCursor(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("ParseCursor(%q) = %+v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCursor(%q) returned unexpected error: %v", tc.in, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected cursor. diff: %s", diff)
+			}
+			// a parsed cursor round-trips in the current format
+			again, err := ParseCursor(got.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(got, again); diff != "" {
+				t.Errorf("cursor does not round-trip. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSaveCursor(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2023, 1, 10, 8, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+	b := NewMemoryBackend()
+	s := Spec{StartDateStr: "2023-01-01"}
+	s.SetDefaults()
+	c := &Client{Logger: zerolog.Nop(), Backend: b, Spec: s, Website: WebsiteSpec{Hostname: "test.com"}}
+
+	// migrate a legacy cursor
+	if err := b.Set(ctx, "t", c.ID(), "2023-01-02"); err != nil {
+		t.Fatal(err)
+	}
+	cur, err := c.loadCursor(ctx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.Next != "2023-01-02" || cur.Fingerprint != "" {
+		t.Errorf("unexpected migrated cursor: %s", cur)
+	}
+
+	p := Progress{Start: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), End: time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)}
+	p.Add(200)
+	p.Add(100)
+	if err := c.SaveCursor(ctx, "t", p); err != nil {
+		t.Fatal(err)
+	}
+	// an empty window keeps the last added_unix
+	p = Progress{Start: time.Date(2023, 1, 4, 0, 0, 0, 0, time.UTC), End: time.Date(2023, 1, 6, 0, 0, 0, 0, time.UTC)}
+	if err := c.SaveCursor(ctx, "t", p); err != nil {
+		t.Fatal(err)
+	}
+	cur, err = c.loadCursor(ctx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Cursor{
+		Version:       CursorVersion,
+		Next:          "2023-01-05",
+		WindowStart:   "2023-01-04",
+		WindowEnd:     "2023-01-06",
+		LastAddedUnix: 200,
+		Fingerprint:   c.fingerprint("t"),
+		Stats:         CursorStats{Syncs: 2, Rows: 0, TotalRows: 2, UpdatedAt: now()},
+	}
+	if diff := cmp.Diff(want, cur); diff != "" {
+		t.Errorf("unexpected cursor. diff: %s", diff)
+	}
+}
+
+func TestHighWaterMark(t *testing.T) {
+	ctx := context.Background()
+	s := Spec{StartDateStr: "2023-01-01", OnConfigChange: ConfigChangeBackfill}
+	s.SetDefaults()
+	c := &Client{Logger: zerolog.Nop(), Backend: NewMemoryBackend(), Spec: s, Website: WebsiteSpec{Hostname: "test.com"}}
+
+	hwm, err := c.HighWaterMark(ctx, "simple_analytics_page_views")
+	if err != nil || hwm != 0 {
+		t.Fatalf("expected no high-water mark without a cursor, got %d (%v)", hwm, err)
+	}
+	if err := c.SaveCursor(ctx, "simple_analytics_page_views", Progress{LastAddedUnix: 10_000}); err != nil {
+		t.Fatal(err)
+	}
+	if hwm, _ = c.HighWaterMark(ctx, "simple_analytics_page_views"); hwm != 10_000-3600 {
+		t.Errorf("expected the high-water mark to be an hour before the last added_unix, got %d", hwm)
+	}
+
+	p := Progress{HighWaterMark: hwm}
+	for addedUnix, want := range map[uint64]bool{0: false, 1: true, 10_000 - 3600: true, 10_000 - 3599: false, 20_000: false} {
+		if got := p.Skip(addedUnix); got != want {
+			t.Errorf("Skip(%d) = %v, want %v", addedUnix, got, want)
+		}
+	}
+	if p.Skipped != 2 {
+		t.Errorf("expected 2 skipped rows, got %d", p.Skipped)
+	}
+
+	c.Spec.SafetyMarginStr = "3h"
+	if hwm, _ = c.HighWaterMark(ctx, "simple_analytics_page_views"); hwm != 0 {
+		t.Errorf("expected no high-water mark if the margin exceeds the last added_unix, got %d", hwm)
+	}
+
+	c.Spec.SafetyMarginStr = "0s"
+	c.Website.MetadataFields = []string{"plan_text"}
+	if hwm, _ = c.HighWaterMark(ctx, "simple_analytics_page_views"); hwm != 0 {
+		t.Errorf("expected no high-water mark when backfilling after a config change, got %d", hwm)
+	}
+}
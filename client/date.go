@@ -0,0 +1,65 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateAnchors are the named dates a date expression can start from, relative to midnight of the current day.
+var dateAnchors = map[string]func(today time.Time) time.Time{
+	"today":     func(today time.Time) time.Time { return today },
+	"yesterday": func(today time.Time) time.Time { return today.AddDate(0, 0, -1) },
+	"start_of_week": func(today time.Time) time.Time {
+		// weeks start on Monday
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	},
+	"start_of_month": func(today time.Time) time.Time {
+		return today.AddDate(0, 0, 1-today.Day())
+	},
+	"start_of_last_month": func(today time.Time) time.Time {
+		return today.AddDate(0, -1, 1-today.Day())
+	},
+	"start_of_year": func(today time.Time) time.Time {
+		return today.AddDate(0, 0, 1-today.YearDay())
+	},
+}
+
+// parseDate evaluates a start_date or end_date value in loc, relative to now. It accepts:
+//   - a date using AllowedTimeLayout, e.g. "2023-01-31"
+//   - an RFC3339 timestamp, e.g. "2023-01-31T12:00:00Z", which is converted to loc
+//   - a named anchor (today, yesterday, start_of_week, start_of_month, start_of_last_month
+//     or start_of_year), optionally followed by "+" or "-" and a period, e.g. "today-7d"
+//     or "start_of_month-1y"
+func parseDate(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation(AllowedTimeLayout, s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), nil
+	}
+	anchor, offset, sign := s, "", 0
+	if i := strings.IndexAny(s, "+-"); i >= 0 {
+		anchor, offset = s[:i], s[i+1:]
+		sign = 1
+		if s[i] == '-' {
+			sign = -1
+		}
+	}
+	fn, ok := dateAnchors[anchor]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+	t := fn(midnight(now.In(loc)))
+	if sign == 0 {
+		return t, nil
+	}
+	p, err := parsePeriod(offset)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid offset in date %q: %w", s, err)
+	}
+	if sign < 0 {
+		return p.Before(t), nil
+	}
+	return t.AddDate(p.Years, p.Months, p.Weeks*7+p.Days), nil
+}
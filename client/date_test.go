@@ -0,0 +1,96 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a Wednesday
+	now := time.Date(2023, 3, 15, 17, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2023-01-31", want: time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{in: "2023-01-31", loc: berlin, want: time.Date(2023, 1, 31, 0, 0, 0, 0, berlin)},
+		{in: "2023-01-31T12:00:00Z", loc: berlin, want: time.Date(2023, 1, 31, 13, 0, 0, 0, berlin)},
+		{in: "2023-01-31T12:00:00+05:00", want: time.Date(2023, 1, 31, 7, 0, 0, 0, time.UTC)},
+		{in: "today", want: time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{in: "yesterday", want: time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{in: "today-7d", want: time.Date(2023, 3, 8, 0, 0, 0, 0, time.UTC)},
+		{in: "today+1d", want: time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{in: "yesterday-2w", want: time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_week", want: time.Date(2023, 3, 13, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_month", want: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_month-1y", want: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_last_month", want: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_year", want: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "start_of_year+1m2d", want: time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC)},
+		// it is already March 16th in Tokyo
+		{in: "today", loc: time.FixedZone("Tokyo", 9*60*60), want: time.Date(2023, 3, 16, 0, 0, 0, 0, time.FixedZone("Tokyo", 9*60*60))},
+		{in: "", wantErr: true},
+		{in: "tomorrow", wantErr: true},
+		{in: "Today", wantErr: true},
+		{in: "today-", wantErr: true},
+		{in: "today-7", wantErr: true},
+		{in: "today-7d-1d", wantErr: true},
+		{in: "today - 7d", wantErr: true},
+		{in: "2023-02-30", wantErr: true},
+		{in: "31/01/2023", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			loc := tc.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+			got, err := parseDate(tc.in, now, loc)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parseDate(%q) = %v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDate(%q) returned unexpected error: %v", tc.in, err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("parseDate(%q) = %v, want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSpecDateExpressions(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2023, 3, 15, 17, 30, 0, 0, time.UTC) }
+	s := Spec{
+		UserID:       "test",
+		APIKey:       "test",
+		Websites:     []WebsiteSpec{{Hostname: "test.com"}},
+		StartDateStr: "start_of_last_month",
+		EndDateStr:   "yesterday",
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	s.SetDefaults()
+	if got, want := s.StartTime(), time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("unexpected start time. got: %v, want: %v", got, want)
+	}
+	if got, want := s.EndTime(), time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("unexpected end time. got: %v, want: %v", got, want)
+	}
+
+	s.StartDateStr = "last_week"
+	if err := s.Validate(); err == nil {
+		t.Error("expected error for unknown date expression, got nil")
+	}
+}
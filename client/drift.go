@@ -0,0 +1,52 @@
+package client
+
+import (
+	"strings"
+	"sync"
+)
+
+// fieldWarnings makes sure schema drift is only logged once per sync, even though
+// it is detected separately by every table and website.
+type fieldWarnings struct {
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func newFieldWarnings() *fieldWarnings {
+	return &fieldWarnings{warned: make(map[string]bool)}
+}
+
+// filter returns the fields that have not been warned about yet for the given export type.
+func (w *fieldWarnings) filter(exportType string, fields []string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var l []string
+	for _, f := range fields {
+		k := exportType + ":" + f
+		if !w.warned[k] {
+			w.warned[k] = true
+			l = append(l, f)
+		}
+	}
+	return l
+}
+
+// OnFieldDrift returns a callback for simpleanalytics.ExportOptions that logs a warning listing
+// unexpected or missing export fields, once per sync for every export type ("pageviews" or "events").
+func (c *Client) OnFieldDrift(exportType string) func(unexpected, missing []string) {
+	return func(unexpected, missing []string) {
+		if c.fieldWarnings == nil {
+			return
+		}
+		unexpected = c.fieldWarnings.filter(exportType+":unexpected", unexpected)
+		missing = c.fieldWarnings.filter(exportType+":missing", missing)
+		if len(unexpected) == 0 && len(missing) == 0 {
+			return
+		}
+		c.Logger.Warn().
+			Str("type", exportType).
+			Str("unexpected_fields", strings.Join(unexpected, ",")).
+			Str("missing_fields", strings.Join(missing, ",")).
+			Msg("export fields differ from what the plugin expects; the Simple Analytics API may have changed")
+	}
+}
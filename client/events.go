@@ -0,0 +1,77 @@
+package client
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// EventTablePrefix is the prefix of tables that events are routed to via event_tables.
+const EventTablePrefix = "simple_analytics_events_"
+
+var reInvalidTableChars = regexp.MustCompile(`[^a-z\d_]+`)
+
+// EventTableName returns the name of the table the given event is routed to.
+func EventTableName(event string) string {
+	return EventTablePrefix + strings.Trim(reInvalidTableChars.ReplaceAllString(strings.ToLower(event), "_"), "_")
+}
+
+// IncludesEvent reports whether the event passes the include_events and exclude_events filters.
+func (w WebsiteSpec) IncludesEvent(event string) bool {
+	for _, p := range w.ExcludeEvents {
+		if ok, _ := path.Match(p, event); ok {
+			return false
+		}
+	}
+	if len(w.IncludeEvents) == 0 {
+		return true
+	}
+	for _, p := range w.IncludeEvents {
+		if ok, _ := path.Match(p, event); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EventTable returns the event table spec the event is routed to, or nil if it is not routed.
+func (w WebsiteSpec) EventTable(event string) *EventTableSpec {
+	for i := range w.EventTables {
+		if w.EventTables[i].Event == event {
+			return &w.EventTables[i]
+		}
+	}
+	return nil
+}
+
+func (w WebsiteSpec) validateEvents(p string, errs *ValidationErrors) {
+	for _, f := range []struct {
+		name     string
+		patterns []string
+	}{{"include_events", w.IncludeEvents}, {"exclude_events", w.ExcludeEvents}} {
+		for i, pattern := range f.patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs.add(fmt.Sprintf("%s.%s[%d]", p, f.name, i), "see https://pkg.go.dev/path#Match for the supported syntax", "invalid event pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	tables := make(map[string]string, len(w.EventTables))
+	for i, et := range w.EventTables {
+		ep := fmt.Sprintf("%s.event_tables[%d].event", p, i)
+		if et.Event == "" {
+			errs.add(ep, "", "every event_tables entry must have an event")
+			continue
+		}
+		name := EventTableName(et.Event)
+		if name == EventTablePrefix {
+			errs.add(ep, "event names must contain at least one letter or digit", "event %q cannot be used as a table name", et.Event)
+			continue
+		}
+		if other, ok := tables[name]; ok {
+			errs.add(ep, "route only one of them to its own table", "events %q and %q would both be routed to table %s", other, et.Event, name)
+			continue
+		}
+		tables[name] = et.Event
+	}
+}
@@ -0,0 +1,41 @@
+package client
+
+import "testing"
+
+func TestWebsiteSpecIncludesEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		event   string
+		want    bool
+	}{
+		{name: "no filters", event: "signup", want: true},
+		{name: "included", include: []string{"signup"}, event: "signup", want: true},
+		{name: "not included", include: []string{"signup"}, event: "login", want: false},
+		{name: "glob included", include: []string{"sign*"}, event: "signup_completed", want: true},
+		{name: "excluded", exclude: []string{"debug_*"}, event: "debug_click", want: false},
+		{name: "exclude wins", include: []string{"*"}, exclude: []string{"signup"}, event: "signup", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := WebsiteSpec{IncludeEvents: tc.include, ExcludeEvents: tc.exclude}
+			if got := w.IncludesEvent(tc.event); got != tc.want {
+				t.Errorf("IncludesEvent(%q) = %v, want %v", tc.event, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEventTableName(t *testing.T) {
+	tests := map[string]string{
+		"signup":        "simple_analytics_events_signup",
+		"Sign Up":       "simple_analytics_events_sign_up",
+		"click.button!": "simple_analytics_events_click_button",
+	}
+	for event, want := range tests {
+		if got := EventTableName(event); got != want {
+			t.Errorf("EventTableName(%q) = %q, want %q", event, got, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"path/filepath"
+)
+
+// Mode defines where data points are read from.
+type Mode string
+
+const (
+	// ModeAPI exports data points from the Simple Analytics API.
+	ModeAPI Mode = "api"
+	// ModeFiles reads data points from the export files configured for every website, without
+	// making any API requests. It is meant to ingest exports downloaded from the dashboard.
+	ModeFiles Mode = "files"
+)
+
+// validateFiles checks the files option of the website at path p.
+func (w WebsiteSpec) validateFiles(p string, mode Mode, errs *ValidationErrors) {
+	switch {
+	case mode != ModeFiles && w.Files != "":
+		errs.add(p+".files", `set mode to "files" to read export files`, "files is only used in files mode")
+	case mode == ModeFiles && w.Files == "":
+		errs.add(p+".files", "set it to a directory or a glob of export files", "files is required in files mode")
+	case w.Files != "":
+		if _, err := filepath.Match(w.Files, ""); err != nil {
+			errs.add(p+".files", "see https://pkg.go.dev/path/filepath#Match for the supported syntax", "invalid files pattern %q: %v", w.Files, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// ConfigChangePolicy defines what happens when the configuration that determines the synced
+// columns and rows of a website changed since its cursor was saved.
+type ConfigChangePolicy string
+
+const (
+	// ConfigChangeBackfill ignores the cursor and syncs again from the start date.
+	ConfigChangeBackfill ConfigChangePolicy = "backfill"
+	// ConfigChangeWarn logs a warning and resumes from the cursor.
+	ConfigChangeWarn ConfigChangePolicy = "warn"
+	// ConfigChangeKeep silently resumes from the cursor.
+	ConfigChangeKeep ConfigChangePolicy = "keep"
+)
+
+// fingerprint returns a hash of the website configuration that affects which rows and columns
+// of the given table are synced, so that a change can be detected on the next sync. Only the
+// configuration relevant to the table is included, so that e.g. adding a conversion event does
+// not backfill page views. Date ranges, lookback and tables are not included, as they do not
+// affect rows that were already synced.
+func (c *Client) fingerprint(table string) string {
+	var config any
+	switch {
+	case table == "simple_analytics_page_views":
+		config = struct {
+			MetadataFields []string
+			ParseUserAgent bool
+		}{
+			MetadataFields: sorted(c.Website.MetadataFields),
+			ParseUserAgent: c.Spec.ParseUserAgent,
+		}
+	case table == "simple_analytics_events":
+		// events routed to event tables are not synced to the events table
+		routed := make([]string, 0, len(c.Website.EventTables))
+		for _, et := range c.Website.EventTables {
+			routed = append(routed, et.Event)
+		}
+		config = struct {
+			MetadataFields []string
+			IncludeEvents  []string
+			ExcludeEvents  []string
+			RoutedEvents   []string
+			ParseUserAgent bool
+		}{
+			MetadataFields: sorted(c.Website.MetadataFields),
+			IncludeEvents:  sorted(c.Website.IncludeEvents),
+			ExcludeEvents:  sorted(c.Website.ExcludeEvents),
+			RoutedEvents:   sorted(routed),
+			ParseUserAgent: c.Spec.ParseUserAgent,
+		}
+	case table == "simple_analytics_conversions":
+		config = struct {
+			ConversionEvents []string
+		}{
+			ConversionEvents: sorted(c.Website.ConversionEvents),
+		}
+	case strings.HasPrefix(table, EventTablePrefix):
+		var et EventTableSpec
+		for _, spec := range c.Website.EventTables {
+			if EventTableName(spec.Event) == table {
+				et = EventTableSpec{Event: spec.Event, MetadataFields: sorted(spec.MetadataFields)}
+			}
+		}
+		config = struct {
+			EventTable     EventTableSpec
+			Included       bool
+			ParseUserAgent bool
+		}{
+			EventTable:     et,
+			Included:       c.Website.IncludesEvent(et.Event),
+			ParseUserAgent: c.Spec.ParseUserAgent,
+		}
+	default:
+		// sessions do not depend on any configuration
+		config = struct{}{}
+	}
+	b, _ := json.Marshal(config)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sorted returns a sorted copy of l, with nil and empty slices treated the same.
+func sorted(l []string) []string {
+	out := make([]string, len(l))
+	copy(out, l)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFingerprint(t *testing.T) {
+	base := WebsiteSpec{
+		Hostname:       "test.com",
+		MetadataFields: []string{"a_text", "b_int"},
+		EventTables:    []EventTableSpec{{Event: "signup", MetadataFields: []string{"plan_text", "seats_int"}}, {Event: "login"}},
+	}
+	tables := []string{
+		"simple_analytics_page_views",
+		"simple_analytics_events",
+		"simple_analytics_conversions",
+		"simple_analytics_sessions",
+		EventTableName("signup"),
+		EventTableName("login"),
+	}
+	fingerprints := func(w WebsiteSpec, parseUserAgent bool) map[string]string {
+		c := &Client{Spec: Spec{ParseUserAgent: parseUserAgent}, Website: w}
+		m := make(map[string]string, len(tables))
+		for _, table := range tables {
+			m[table] = c.fingerprint(table)
+		}
+		return m
+	}
+	want := fingerprints(base, false)
+
+	tests := []struct {
+		name           string
+		modify         func(w *WebsiteSpec)
+		parseUserAgent bool
+		wantChanged    []string
+	}{
+		{name: "metadata field order", modify: func(w *WebsiteSpec) { w.MetadataFields = []string{"b_int", "a_text"} }},
+		{name: "event table order", modify: func(w *WebsiteSpec) {
+			w.EventTables = []EventTableSpec{{Event: "login", MetadataFields: []string{}}, {Event: "signup", MetadataFields: []string{"seats_int", "plan_text"}}}
+		}},
+		{name: "date range", modify: func(w *WebsiteSpec) { w.StartDateStr, w.EndDateStr = "2019-01-01", "yesterday" }},
+		{name: "lookback", modify: func(w *WebsiteSpec) { w.LookbackStr = "3d" }},
+		{name: "tables", modify: func(w *WebsiteSpec) { w.Tables = []string{"simple_analytics_events"} }},
+		{name: "empty lists", modify: func(w *WebsiteSpec) { w.IncludeEvents = []string{} }},
+		{
+			name:        "metadata fields",
+			modify:      func(w *WebsiteSpec) { w.MetadataFields = []string{"a_text"} },
+			wantChanged: []string{"simple_analytics_events", "simple_analytics_page_views"},
+		},
+		{
+			name:        "conversion events",
+			modify:      func(w *WebsiteSpec) { w.ConversionEvents = []string{"signup"} },
+			wantChanged: []string{"simple_analytics_conversions"},
+		},
+		{
+			name:        "include events",
+			modify:      func(w *WebsiteSpec) { w.IncludeEvents = []string{"sign*"} },
+			wantChanged: []string{"simple_analytics_events", EventTableName("login")},
+		},
+		{
+			name:        "exclude events",
+			modify:      func(w *WebsiteSpec) { w.ExcludeEvents = []string{"login"} },
+			wantChanged: []string{"simple_analytics_events", EventTableName("login")},
+		},
+		{
+			name: "event table fields",
+			modify: func(w *WebsiteSpec) {
+				w.EventTables = []EventTableSpec{{Event: "signup", MetadataFields: []string{"plan_text"}}, {Event: "login"}}
+			},
+			wantChanged: []string{EventTableName("signup")},
+		},
+		{
+			name: "new event table",
+			modify: func(w *WebsiteSpec) {
+				w.EventTables = append(w.EventTables[:2:2], EventTableSpec{Event: "logout"})
+			},
+			wantChanged: []string{"simple_analytics_events"},
+		},
+		{
+			name:           "parse user agent",
+			modify:         func(w *WebsiteSpec) {},
+			parseUserAgent: true,
+			wantChanged:    []string{"simple_analytics_events", "simple_analytics_page_views", EventTableName("login"), EventTableName("signup")},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := base
+			tc.modify(&w)
+			var changed []string
+			for table, fp := range fingerprints(w, tc.parseUserAgent) {
+				if fp != want[table] {
+					changed = append(changed, table)
+				}
+			}
+			sort.Strings(changed)
+			sort.Strings(tc.wantChanged)
+			if diff := cmp.Diff(tc.wantChanged, changed); diff != "" {
+				t.Errorf("unexpected tables with a changed fingerprint. diff: %s", diff)
+			}
+		})
+	}
+}
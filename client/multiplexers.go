@@ -1,12 +1,73 @@
 package client
 
-import "github.com/cloudquery/plugin-sdk/schema"
+import (
+	"path"
 
-func WebsiteMultiplex(meta schema.ClientMeta) []schema.ClientMeta {
+	"github.com/cloudquery/plugin-sdk/schema"
+)
+
+// WebsiteMultiplex returns a multiplexer that creates a client for every website of every account
+// that syncs the given table.
+func WebsiteMultiplex(table string) func(meta schema.ClientMeta) []schema.ClientMeta {
+	return func(meta schema.ClientMeta) []schema.ClientMeta {
+		var l = make([]schema.ClientMeta, 0)
+		client := meta.(*Client)
+		for _, a := range client.accounts {
+			for _, website := range a.Websites {
+				if !website.SyncsTable(table) {
+					continue
+				}
+				wc := client.withWebsite(a, website)
+				if client.shared != nil {
+					client.shared.addTable(wc, table)
+				}
+				if client.syncRuns != nil {
+					wc.run = client.syncRuns.expect(wc, table)
+				}
+				l = append(l, wc)
+			}
+		}
+		return l
+	}
+}
+
+// SyncRunsMultiplex is the multiplexer of the sync runs table. It returns a client for every website
+// of every account, whether it syncs other tables or not, and only the last one collects the runs.
+//
+// This depends on two behaviours of the SDK schedulers (plugin-sdk v1), pinned by TestSchedulerOrder:
+//   - All multiplexers are called before any table is resolved, so every run is expected before
+//     the runs are collected.
+//   - The clients of all tables are given a table slot one at a time and in order: table by table
+//     for the DFS scheduler, and interleaved by client index for the round-robin scheduler.
+//
+// As the sync runs table comes last and every other table has at most one client per website, the
+// last client of the sync runs table is always the last to get a slot. When it waits for the runs,
+// all other resolvers already have theirs, so waiting never holds up another table, whatever the
+// concurrency. If a scheduler ever starts clients in another order, the wait can hang the sync.
+func SyncRunsMultiplex(meta schema.ClientMeta) []schema.ClientMeta {
 	var l = make([]schema.ClientMeta, 0)
 	client := meta.(*Client)
-	for _, website := range client.Spec.Websites {
-		l = append(l, client.withWebsite(website))
+	for _, a := range client.accounts {
+		for _, website := range a.Websites {
+			l = append(l, client.withWebsite(a, website))
+		}
+	}
+	if len(l) == 0 {
+		return []schema.ClientMeta{client}
 	}
+	l[len(l)-1].(*Client).collectsSyncRuns = true
 	return l
 }
+
+// SyncsTable reports whether the table should be synced for the website, according to tables.
+func (w WebsiteSpec) SyncsTable(table string) bool {
+	if len(w.Tables) == 0 {
+		return true
+	}
+	for _, p := range w.Tables {
+		if ok, _ := path.Match(p, table); ok {
+			return true
+		}
+	}
+	return false
+}
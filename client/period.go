@@ -0,0 +1,69 @@
+package client
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// rePeriod matches one or more period components in descending order of size, e.g. "1y6m" or "2w3d".
+var rePeriod = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)m)?(?:(\d+)w)?(?:(\d+)d)?$`)
+
+// maxPeriodDays is the longest supported period, in (approximate) days. Anything longer would
+// reach back before Simple Analytics existed anyway, and guards against overflows.
+const maxPeriodDays = 100 * 366
+
+// Period is a calendar period. Years and months are applied using calendar semantics, clamped
+// to the end of the month, so "1m" on March 31st reaches back to the last day of February.
+type Period struct {
+	Years  int
+	Months int
+	Weeks  int
+	Days   int
+}
+
+// Before returns the time the period reaches back to from t, keeping t's time of day and location.
+func (p Period) Before(t time.Time) time.Time {
+	y, m, d := t.Date()
+	// subtract years and months on the 1st, so that time.Date does not overflow into the next month
+	first := time.Date(y, m, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location()).AddDate(-p.Years, -p.Months, 0)
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1-(p.Weeks*7+p.Days))
+}
+
+// IsZero reports whether the period is empty.
+func (p Period) IsZero() bool {
+	return p == Period{}
+}
+
+func parsePeriod(s string) (Period, error) {
+	m := rePeriod.FindStringSubmatch(s)
+	if m == nil || s == "" {
+		return Period{}, errors.New("invalid period")
+	}
+	var n [4]int
+	for i, v := range m[1:] {
+		if v == "" {
+			continue
+		}
+		var err error
+		n[i], err = strconv.Atoi(v)
+		if err != nil || n[i] > maxPeriodDays {
+			return Period{}, errors.New("period too large")
+		}
+	}
+	p := Period{Years: n[0], Months: n[1], Weeks: n[2], Days: n[3]}
+	if p.Years*366+p.Months*31+p.Weeks*7+p.Days > maxPeriodDays {
+		return Period{}, errors.New("period too large")
+	}
+	return p, nil
+}
+
+// midnight returns the start of the day of t, in t's location.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// reEnvRef matches a value that is a single ${NAME} reference to an environment variable.
+var reEnvRef = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// filePrefix marks a secret that is read from a file, e.g. "file:/var/run/secrets/simple-analytics/api_key".
+const filePrefix = "file:"
+
+// resolveSecrets replaces references in the user_id and api_key of all accounts with the values they point to.
+// Errors never include the resolved values.
+func (s *Spec) resolveSecrets() error {
+	type field struct {
+		path  string
+		value *string
+	}
+	fields := []field{{"user_id", &s.UserID}, {"api_key", &s.APIKey}}
+	for i := range s.Accounts {
+		p := fmt.Sprintf("accounts[%d].", i)
+		fields = append(fields, field{p + "user_id", &s.Accounts[i].UserID}, field{p + "api_key", &s.Accounts[i].APIKey})
+	}
+	var errs ValidationErrors
+	for _, f := range fields {
+		v, err := resolveSecret(*f.value)
+		if err != nil {
+			errs.add(f.path, "", "%v", err)
+			continue
+		}
+		*f.value = v
+	}
+	return errs.err()
+}
+
+// resolveSecret resolves a single secret value, which may be:
+//   - a literal value
+//   - a reference to an environment variable, e.g. "${SA_API_KEY}". Only a value that consists of a
+//     single reference is expanded; "${" anywhere else in a value is taken literally.
+//   - "file:" followed by the path of a file containing the value, e.g. a mounted Kubernetes secret.
+//     The path may be a single ${NAME} reference, and surrounding whitespace in the file is ignored.
+func resolveSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, filePrefix) {
+		return expandEnvRef(value)
+	}
+	name, err := expandEnvRef(strings.TrimPrefix(value, filePrefix))
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		// the error from os.ReadFile includes the path, but never the file contents
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// expandEnvRef returns the value of the environment variable if value is a ${NAME} reference, and
+// value itself otherwise. A reference to a variable that is not set is an error.
+func expandEnvRef(value string) (string, error) {
+	m := reEnvRef.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+	v, ok := os.LookupEnv(m[1])
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", m[1])
+	}
+	return v, nil
+}
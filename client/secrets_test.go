@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudquery/plugin-sdk/plugins/source"
+	"github.com/cloudquery/plugin-sdk/specs"
+	"github.com/rs/zerolog"
+)
+
+const testSecret = "s3cr3t-api-key"
+
+func TestResolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "api_key"), []byte(testSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SA_TEST_API_KEY", testSecret)
+	t.Setenv("SA_TEST_SECRETS_FILE", filepath.Join(dir, "api_key"))
+	t.Setenv("SA_TEST_EMPTY", "")
+	t.Setenv("SA_TEST_FILE_REF", "file:"+filepath.Join(dir, "api_key"))
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "literal", want: "literal"},
+		{in: "$NOT_A_REF", want: "$NOT_A_REF"},
+		{in: "${SA_TEST_API_KEY}", want: testSecret},
+		{in: "prefix-${SA_TEST_API_KEY}", want: "prefix-${SA_TEST_API_KEY}"},
+		{in: "${SA_TEST_API_KEY}${SA_TEST_API_KEY}", want: "${SA_TEST_API_KEY}${SA_TEST_API_KEY}"},
+		{in: "${SA_TEST_EMPTY}", want: ""},
+		{in: "file:" + filepath.Join(dir, "api_key"), want: testSecret},
+		{in: "file:${SA_TEST_SECRETS_FILE}", want: testSecret},
+		// references are resolved once, so a variable cannot point to a file
+		{in: "${SA_TEST_FILE_REF}", want: "file:" + filepath.Join(dir, "api_key")},
+		{in: "${SA_TEST_MISSING}", wantErr: "environment variable SA_TEST_MISSING is not set"},
+		{in: "file:${SA_TEST_MISSING}", wantErr: "environment variable SA_TEST_MISSING is not set"},
+		{in: "file:" + filepath.Join(dir, "missing"), wantErr: "failed to read secret file"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := resolveSecret(tc.in)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("resolveSecret(%q) returned error %v, want error containing %q", tc.in, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveSecret(%q) returned unexpected error: %v", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("resolveSecret(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewResolvesSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "api_key"), []byte(testSecret), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SA_TEST_USER_ID", "user-1")
+
+	newClient := func(spec map[string]any) (*Client, error) {
+		meta, err := New(context.Background(), zerolog.Nop(), specs.Source{Spec: spec}, source.Options{})
+		if err != nil {
+			return nil, err
+		}
+		return meta.(*Client), nil
+	}
+
+	c, err := newClient(map[string]any{
+		"user_id":  "${SA_TEST_USER_ID}",
+		"api_key":  "file:" + filepath.Join(dir, "api_key"),
+		"websites": []map[string]any{{"hostname": "test.com"}},
+		"accounts": []map[string]any{{
+			"name":     "other",
+			"user_id":  "${SA_TEST_USER_ID}",
+			"api_key":  "file:" + filepath.Join(dir, "api_key"),
+			"websites": []map[string]any{{"hostname": "other.com"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Spec.UserID != "user-1" || c.Spec.APIKey != testSecret {
+		t.Errorf("secrets were not resolved: user_id %q, api_key of length %d", c.Spec.UserID, len(c.Spec.APIKey))
+	}
+	if a := c.Spec.Accounts[0]; a.UserID != "user-1" || a.APIKey != testSecret {
+		t.Errorf("account secrets were not resolved: user_id %q, api_key of length %d", a.UserID, len(a.APIKey))
+	}
+
+	// Errors must never include the secrets, neither for resolution nor for validation.
+	for name, spec := range map[string]map[string]any{
+		"missing variable": {
+			"user_id":  "${SA_TEST_MISSING}",
+			"api_key":  "file:" + filepath.Join(dir, "api_key"),
+			"websites": []map[string]any{{"hostname": "test.com"}},
+		},
+		"invalid spec": {
+			"user_id": "${SA_TEST_USER_ID}",
+			"api_key": "file:" + filepath.Join(dir, "api_key"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := newClient(spec)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if strings.Contains(err.Error(), testSecret) {
+				t.Errorf("error contains the secret: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import "sync"
+
+// shared holds what the clients of the tables of a website share during a sync: the tables that
+// are synced for the website, and downloads used by several of them.
+type shared struct {
+	mu      sync.Mutex
+	tables  map[string]bool
+	results map[string]*sharedResult
+}
+
+type sharedResult struct {
+	once  sync.Once
+	value any
+	err   error
+}
+
+func newShared() *shared {
+	return &shared{tables: make(map[string]bool), results: make(map[string]*sharedResult)}
+}
+
+// addTable records that the table is synced for the client's website.
+func (s *shared) addTable(c *Client, table string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables[c.ID()+":"+table] = true
+}
+
+func (s *shared) result(c *Client, key string) *sharedResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := c.ID() + ":" + key
+	if s.results[k] == nil {
+		s.results[k] = &sharedResult{}
+	}
+	return s.results[k]
+}
+
+// SyncsTable reports whether the table is synced for the client's website in this sync, i.e. it
+// was selected and its multiplexer returned a client for the website.
+func (c *Client) SyncsTable(table string) bool {
+	if c.shared == nil {
+		return c.Website.SyncsTable(table)
+	}
+	c.shared.mu.Lock()
+	defer c.shared.mu.Unlock()
+	return c.shared.tables[c.ID()+":"+table]
+}
+
+// Shared returns the result of fetch for the given key and the client's website. fetch is only
+// called once per sync, by the first table to ask for the key; the other tables of the website
+// wait for and get the same result, so that they can share a single download.
+func (c *Client) Shared(key string, fetch func() (any, error)) (any, error) {
+	if c.shared == nil {
+		return fetch()
+	}
+	r := c.shared.result(c, key)
+	r.once.Do(func() {
+		r.value, r.err = fetch()
+	})
+	return r.value, r.err
+}
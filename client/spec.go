@@ -1,133 +1,432 @@
 package client
 
 import (
-	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
+	"path"
+	"strings"
 	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
 )
 
 // DefaultStartTime defaults to the year SA was founded (we assume there were no data before that)
 var DefaultStartTime = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
 
-// AllowedTimeLayout is the layout used for the start_time and end_time fields, and matches what the export API supports
+// AllowedTimeLayout is the date layout used for the start_date and end_date fields and cursors, and matches what the export API supports
 var AllowedTimeLayout = "2006-01-02"
 
-var reValidDuration = regexp.MustCompile(`^(\d+)([dmy])$`)
+// now is overridden in tests.
+var now = time.Now
+
+// maxConcurrency limits concurrency to stay well within the rate limits of the export API.
+const maxConcurrency = 16
+
+const periodHint = `should be numbers followed by "y", "m", "w" or "d", in that order, e.g. "7d", "2w", "1m" or "1y6m"`
+
+const dateHint = `should be a date like "2023-01-31", an RFC3339 timestamp, or one of today, yesterday, start_of_week, start_of_month, start_of_last_month or start_of_year, optionally followed by an offset like "-7d"`
 
 type Spec struct {
 	// UserID is the Simple Analytics API user ID.
+	// Like APIKey, it can reference an environment variable as "${NAME}" (the whole value), or a file as "file:<path>".
 	UserID string `json:"user_id"`
 
 	// APIKey is the Simple Analytics API key.
+	// It can reference an environment variable as "${NAME}" (the whole value), or a file as "file:<path>".
 	APIKey string `json:"api_key"`
 
-	// Websites is a list of websites to fetch data for.
+	// Websites is a list of websites to fetch data for using UserID and APIKey.
 	Websites []WebsiteSpec `json:"websites"`
 
-	// StartDateStr is the time to start fetching data from. If specified, it must use AllowedTimeLayout.
+	// Accounts lists additional Simple Analytics accounts, each with its own credentials and websites.
+	// It can be used instead of, or in addition to, the top-level UserID, APIKey and Websites.
+	Accounts []AccountSpec `json:"accounts"`
+
+	// StartDateStr is the time to start fetching data from. It can be a date using AllowedTimeLayout,
+	// an RFC3339 timestamp or an expression evaluated at sync time, e.g. "yesterday", "today-7d"
+	// or "start_of_last_month". See parseDate for the full grammar.
 	StartDateStr string `json:"start_date"`
 
 	// EndDateStr is the time at which to stop fetching data. If not specified, the current time is used.
-	// If specified, it must use AllowedTimeLayout.
+	// It accepts the same values as StartDateStr.
 	EndDateStr string `json:"end_date"`
 
-	// PeriodStr is the duration of the time window to fetch historical data for, in days, months or years.
+	// PeriodStr is the duration of the time window to fetch historical data for, in years, months, weeks or days.
+	// Components can be combined, in that order, and are applied using calendar semantics
+	// from midnight of the current day in Timezone.
 	// Examples:
 	//  "7d": past 7 days
+	//  "2w": past 2 weeks
 	//  "3m": last 3 months
-	//  "1y": last year
-	// It is used to calculate start_time if it is not specified. If start_time is specified,
-	// duration is ignored.
+	//  "1y6m": last year and a half
+	// It is used to calculate the start date, and cannot be combined with start_date.
 	PeriodStr string `json:"duration"`
+
+	// LookbackStr is how far the next incremental sync reaches back from the end of the previous one,
+	// to pick up data points that were added late. It uses the same format as PeriodStr. Defaults to "1d".
+	LookbackStr string `json:"lookback"`
+
+	// SafetyMarginStr is subtracted from the highest added_unix synced so far to get the high-water mark.
+	// Page views and events added at or before the high-water mark are not synced again, even if they
+	// are within the lookback. It is a Go duration, e.g. "30m" or "2h". Defaults to "1h".
+	SafetyMarginStr string `json:"safety_margin"`
+
+	// OnConfigChange is the policy applied when the configuration that determines the synced rows and
+	// columns of a website (metadata fields, event filters and tables, conversion events and user agent
+	// parsing) changed since the last incremental sync: "backfill", "warn" or "keep". Defaults to "warn".
+	// Changes are detected per table, so only the tables whose configuration changed are affected.
+	OnConfigChange ConfigChangePolicy `json:"on_config_change"`
+
+	// Concurrency is the number of days exported in parallel per website and table. If it is above
+	// one, every day is exported with a separate request, and rows are still delivered in order.
+	// Defaults to 1, which exports the whole window with a single request. It is ignored in files mode.
+	Concurrency int `json:"concurrency"`
+
+	// Backfill syncs the selected websites and tables for the given window, bypassing their stored
+	// cursors. It is meant to be set for a single run.
+	Backfill []BackfillSpec `json:"backfill"`
+
+	// ResetCursor bypasses the stored cursors of all websites and tables, syncing again from the
+	// start date. Unlike backfill, it always saves the cursors afterwards.
+	ResetCursor bool `json:"reset_cursor"`
+
+	// Mode is where data points are read from: "api" exports them from the Simple Analytics API, and
+	// "files" reads them from the export files set in the files option of every website, without
+	// needing credentials. Defaults to "api".
+	Mode Mode `json:"mode"`
+
+	// Format is the format data points are exported in: "ndjson" or "csv". Defaults to "ndjson".
+	// CSV is a fallback in case the NDJSON export misbehaves.
+	Format simpleanalytics.Format `json:"format"`
+
+	// ArchiveDir, if set, is a local directory that the body of every export response is written to,
+	// exactly as received and partitioned by website, type and start date, for auditing. Every
+	// response is recorded with its request parameters, content encoding, hash and row count in
+	// manifest.ndjson in the directory.
+	ArchiveDir string `json:"archive_dir"`
+
+	// Timezone is the IANA time zone that dates and periods are evaluated in. Defaults to UTC.
+	Timezone string `json:"timezone"`
+
+	// ParseUserAgent enables offline parsing of user agents into the ua_* columns of the
+	// page view and event tables (engine, device brand and model, and whether it is a webview).
+	ParseUserAgent bool `json:"parse_user_agent"`
 }
 
 type WebsiteSpec struct {
 	Hostname       string   `json:"hostname"`
 	MetadataFields []string `json:"metadata_fields"`
+
+	// ConversionEvents is a list of event names (datapoints) to attribute to the landing page
+	// of their session in the simple_analytics_conversions table.
+	ConversionEvents []string `json:"conversion_events"`
+
+	// IncludeEvents and ExcludeEvents filter exported events by name (datapoint). Both accept glob
+	// patterns as supported by path.Match, e.g. "signup_*". Exclusions take precedence over inclusions.
+	// If IncludeEvents is empty, all events are included.
+	IncludeEvents []string `json:"include_events"`
+	ExcludeEvents []string `json:"exclude_events"`
+
+	// EventTables routes the listed events to their own simple_analytics_events_<event> tables,
+	// with typed columns for their metadata fields, instead of simple_analytics_events.
+	EventTables []EventTableSpec `json:"event_tables"`
+
+	// StartDateStr, EndDateStr, PeriodStr and LookbackStr override the top-level options of the
+	// same name for this website. Setting either start_date or duration replaces both top-level ones.
+	StartDateStr string `json:"start_date"`
+	EndDateStr   string `json:"end_date"`
+	PeriodStr    string `json:"duration"`
+	LookbackStr  string `json:"lookback"`
+
+	// Files is a directory or a glob of export files to read the data points of this website from
+	// in files mode. Files are NDJSON (.ndjson, .jsonl or .json) or CSV (.csv), optionally gzipped
+	// (.gz). Rows of other websites are skipped, so several websites can share the same files.
+	Files string `json:"files"`
+
+	// Tables limits the tables synced for this website. It accepts table names or glob patterns as
+	// supported by path.Match, e.g. "simple_analytics_events_*". If empty, all tables are synced.
+	Tables []string `json:"tables"`
+}
+
+type EventTableSpec struct {
+	// Event is the exact event name (datapoint) to route.
+	Event string `json:"event"`
+
+	// MetadataFields are exported as typed metadata_<name> columns. The type is derived from the
+	// field suffix used by Simple Analytics: _text, _int, _bool or _date.
+	MetadataFields []string `json:"metadata_fields"`
 }
 
+// Validate checks the spec and returns all problems found as ValidationErrors.
 func (s Spec) Validate() error {
-	if s.UserID == "" {
-		return fmt.Errorf("user_id is required")
+	var errs ValidationErrors
+	names := make(map[string]int, len(s.Accounts))
+	for i, a := range s.Accounts {
+		p := fmt.Sprintf("accounts[%d].name", i)
+		if a.Name == "" {
+			errs.add(p, "", "every account entry must have a name")
+		} else if !reAccountName.MatchString(a.Name) {
+			errs.add(p, "use only letters, digits, dots, dashes and underscores", "invalid account name %q", a.Name)
+		} else if j, ok := names[a.Name]; ok {
+			errs.add(p, fmt.Sprintf("rename it or merge it with accounts[%d]", j), "account name %q is already used", a.Name)
+		} else {
+			names[a.Name] = i
+		}
+	}
+	switch s.Mode {
+	case "", ModeAPI, ModeFiles:
+	default:
+		errs.add("mode", `should be "api" or "files"`, "invalid mode %q", s.Mode)
+	}
+	for _, ref := range s.accountRefs() {
+		ref.account.validate(ref.path, s.Mode, &errs)
+	}
+
+	if s.SafetyMarginStr != "" {
+		if d, err := time.ParseDuration(s.SafetyMarginStr); err != nil {
+			errs.add("safety_margin", `should be a duration like "30m" or "2h"`, "could not parse safety_margin: %v", err)
+		} else if d < 0 {
+			errs.add("safety_margin", "use 0 to filter all rows synced before", "safety_margin must not be negative")
+		}
+	}
+	if s.Concurrency < 0 || s.Concurrency > maxConcurrency {
+		errs.add("concurrency", fmt.Sprintf("use a value between 1 and %d", maxConcurrency), "invalid concurrency %d", s.Concurrency)
+	}
+	switch s.OnConfigChange {
+	case "", ConfigChangeBackfill, ConfigChangeWarn, ConfigChangeKeep:
+	default:
+		errs.add("on_config_change", `should be "backfill", "warn" or "keep"`, "invalid policy %q", s.OnConfigChange)
+	}
+	switch s.Format {
+	case "", simpleanalytics.FormatNDJSON, simpleanalytics.FormatCSV:
+	default:
+		errs.add("format", `should be "ndjson" or "csv"`, "invalid format %q", s.Format)
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		errs.add("timezone", `use an IANA time zone name like "UTC" or "Europe/Berlin"`, "could not load timezone: %v", err)
+		return errs.err()
+	}
+	today := midnight(now().In(loc))
+	global := dateRange{start: s.StartDateStr, end: s.EndDateStr, period: s.PeriodStr}
+	validateDateRange(&errs, "", global, dateRange{}, loc, today)
+	validateLookback(&errs, "lookback", s.LookbackStr)
+	s.validateBackfill(&errs, loc, today)
+	for _, ref := range s.accountRefs() {
+		for i, w := range ref.account.Websites {
+			p := fmt.Sprintf("%swebsites[%d].", ref.path, i)
+			if own := (dateRange{start: w.StartDateStr, end: w.EndDateStr, period: w.PeriodStr}); own != (dateRange{}) {
+				validateDateRange(&errs, p, own, global, loc, today)
+			}
+			validateLookback(&errs, p+"lookback", w.LookbackStr)
+		}
+	}
+	return errs.err()
+}
+
+// validate validates the credentials and websites of the account, whose fields are prefixed with p.
+func (a AccountSpec) validate(p string, mode Mode, errs *ValidationErrors) {
+	// credentials are not needed to read export files
+	if a.UserID == "" && mode != ModeFiles {
+		errs.add(p+"user_id", "", "user_id is required")
 	}
-	if s.APIKey == "" {
-		return fmt.Errorf("api_key is required")
+	if a.APIKey == "" && mode != ModeFiles {
+		errs.add(p+"api_key", "", "api_key is required")
 	}
-	if len(s.Websites) == 0 {
-		return fmt.Errorf("at least one website is required")
+	if len(a.Websites) == 0 {
+		errs.add(p+"websites", "", "at least one website is required")
 	}
-	for _, w := range s.Websites {
+	hostnames := make(map[string]int, len(a.Websites))
+	for i, w := range a.Websites {
+		wp := fmt.Sprintf("%swebsites[%d]", p, i)
 		if w.Hostname == "" {
-			return fmt.Errorf("every website entry must have a hostname")
+			errs.add(wp+".hostname", "", "every website entry must have a hostname")
+		} else if h, ok := cleanHostname(w.Hostname); !ok {
+			errs.add(wp+".hostname", fmt.Sprintf("use %q instead", h), "hostname %q must not contain a scheme, path or query", w.Hostname)
+		} else if j, ok := hostnames[strings.ToLower(h)]; ok {
+			errs.add(wp+".hostname", fmt.Sprintf("merge it with %swebsites[%d]", p, j), "hostname %q is already configured", w.Hostname)
+		} else {
+			hostnames[strings.ToLower(h)] = i
+		}
+		w.validateEvents(wp, errs)
+		w.validateFiles(wp, mode, errs)
+		for j, pattern := range w.Tables {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs.add(fmt.Sprintf("%s.tables[%d]", wp, j), "see https://pkg.go.dev/path#Match for the supported syntax", "invalid table pattern %q: %v", pattern, err)
+			}
+		}
+	}
+}
+
+// dateRange holds the date options of the spec or of a website override.
+type dateRange struct {
+	start, end, period string
+}
+
+// validateDateRange validates the own date options, which are prefixed with p, and checks that
+// the resulting window is not empty after applying them on top of the inherited options.
+// Problems with inherited options are not reported, as they are reported for the top-level spec.
+func validateDateRange(errs *ValidationErrors, p string, own, inherited dateRange, loc *time.Location, today time.Time) {
+	start, end := DefaultStartTime.In(loc), today
+	startPath := "start_date"
+	if inherited.period != "" {
+		start, startPath = time.Time{}, "duration"
+		if pe, err := parsePeriod(inherited.period); err == nil {
+			start = pe.Before(today)
+		}
+	}
+	if inherited.start != "" {
+		start, startPath = time.Time{}, "start_date"
+		if t, err := parseDate(inherited.start, now(), loc); err == nil {
+			start = t
+		}
+	}
+	if inherited.end != "" {
+		end = time.Time{}
+		if t, err := parseDate(inherited.end, now(), loc); err == nil && !midnight(t).After(today) {
+			end = t
 		}
 	}
-	if s.StartDateStr != "" {
-		_, err := time.Parse(AllowedTimeLayout, s.StartDateStr)
-		if err != nil {
-			return fmt.Errorf("could not parse start_time: %v", err)
+
+	if own.period != "" {
+		start, startPath = time.Time{}, p+"duration"
+		if pe, err := parsePeriod(own.period); err != nil {
+			errs.add(p+"duration", periodHint, "could not parse duration: %v", err)
+		} else {
+			start = pe.Before(today)
+		}
+		if own.start != "" {
+			errs.add(p+"duration", "remove either duration or start_date", "duration and start_date are mutually exclusive")
 		}
 	}
-	if s.EndDateStr != "" {
-		_, err := time.Parse(AllowedTimeLayout, s.EndDateStr)
-		if err != nil {
-			return fmt.Errorf("could not parse end_time: %v", err)
+	if own.start != "" {
+		start, startPath = time.Time{}, p+"start_date"
+		if t, err := parseDate(own.start, now(), loc); err != nil {
+			errs.add(p+"start_date", dateHint, "could not parse start_date: %v", err)
+		} else {
+			start = t
 		}
 	}
-	if s.PeriodStr != "" {
-		_, err := parsePeriod(s.PeriodStr)
-		if err != nil {
-			return fmt.Errorf("could not validate period: %v (should be a number followed by \"d\", \"m\" or \"y\", e.g. \"7d\", \"1m\" or \"3y\")", err)
+	if own.end != "" {
+		end = time.Time{}
+		if t, err := parseDate(own.end, now(), loc); err != nil {
+			errs.add(p+"end_date", dateHint, "could not parse end_date: %v", err)
+		} else if midnight(t).After(today) {
+			errs.add(p+"end_date", "omit end_date to sync up to today", "end_date %s is in the future", t.Format(AllowedTimeLayout))
+		} else {
+			end = t
 		}
 	}
-	return nil
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		errs.add(startPath, "start must not be after end_date", "start %s is after end %s", start.Format(AllowedTimeLayout), end.Format(AllowedTimeLayout))
+	}
+}
+
+func validateLookback(errs *ValidationErrors, p, lookback string) {
+	if lookback == "" {
+		return
+	}
+	if _, err := parsePeriod(lookback); err != nil {
+		errs.add(p, periodHint, "could not parse lookback: %v", err)
+	}
+}
+
+// cleanHostname returns the hostname with any scheme, path, query and fragment removed,
+// and whether it was already clean.
+func cleanHostname(hostname string) (string, bool) {
+	h := hostname
+	if _, rest, ok := strings.Cut(h, "://"); ok {
+		h = rest
+	}
+	if i := strings.IndexAny(h, "/?#"); i >= 0 {
+		h = h[:i]
+	}
+	return h, h == hostname
 }
 
 func (s *Spec) SetDefaults() {
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
 	if s.StartDateStr == "" && s.PeriodStr == "" {
 		s.StartDateStr = DefaultStartTime.Format(AllowedTimeLayout)
 	}
 	if s.EndDateStr == "" {
-		s.EndDateStr = time.Now().Format(AllowedTimeLayout)
+		s.EndDateStr = now().In(s.Location()).Format(AllowedTimeLayout)
+	}
+	if s.LookbackStr == "" {
+		s.LookbackStr = "1d"
+	}
+	if s.SafetyMarginStr == "" {
+		s.SafetyMarginStr = "1h"
+	}
+	if s.Concurrency == 0 {
+		s.Concurrency = 1
+	}
+	if s.OnConfigChange == "" {
+		s.OnConfigChange = ConfigChangeWarn
+	}
+	if s.Format == "" {
+		s.Format = simpleanalytics.FormatNDJSON
+	}
+	if s.Mode == "" {
+		s.Mode = ModeAPI
 	}
 }
 
+// forWebsite returns the spec with the overrides of the given website applied.
+func (s Spec) forWebsite(w WebsiteSpec) Spec {
+	switch {
+	case w.StartDateStr != "":
+		s.StartDateStr, s.PeriodStr = w.StartDateStr, ""
+	case w.PeriodStr != "":
+		s.StartDateStr, s.PeriodStr = "", w.PeriodStr
+	}
+	if w.EndDateStr != "" {
+		s.EndDateStr = w.EndDateStr
+	}
+	if w.LookbackStr != "" {
+		s.LookbackStr = w.LookbackStr
+	}
+	return s
+}
+
+// Location returns the location of Timezone. Any error should be caught by Validate().
+func (s Spec) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// StartTime returns the start date in Timezone, at midnight unless it is an RFC3339 timestamp.
+// If no start date is set, it is calculated by going back the configured period from midnight of the current day.
 func (s Spec) StartTime() time.Time {
 	if s.StartDateStr == "" && s.PeriodStr != "" {
-		return time.Now().Add(-s.Period())
+		return s.Period().Before(midnight(now().In(s.Location())))
 	}
-	t, _ := time.Parse(AllowedTimeLayout, s.StartDateStr) // any error should be caught by Validate()
+	t, _ := parseDate(s.StartDateStr, now(), s.Location()) // any error should be caught by Validate()
 	return t
 }
 
+// EndTime returns the end date in Timezone, at midnight unless it is an RFC3339 timestamp.
 func (s Spec) EndTime() time.Time {
-	t, _ := time.Parse(AllowedTimeLayout, s.EndDateStr) // any error should be caught by Validate()
+	t, _ := parseDate(s.EndDateStr, now(), s.Location()) // any error should be caught by Validate()
 	return t
 }
 
-func (s Spec) Period() time.Duration {
-	d, _ := parsePeriod(s.PeriodStr) // any error should be caught by Validate()
+func (s Spec) Period() Period {
+	p, _ := parsePeriod(s.PeriodStr) // any error should be caught by Validate()
+	return p
+}
+
+func (s Spec) SafetyMargin() time.Duration {
+	d, _ := time.ParseDuration(s.SafetyMarginStr) // any error should be caught by Validate()
 	return d
 }
 
-func parsePeriod(s string) (time.Duration, error) {
-	m := reValidDuration.FindStringSubmatch(s)
-	if m == nil {
-		return 0, errors.New("invalid period")
-	}
-	n, err := strconv.Atoi(m[1])
-	if err != nil {
-		return 0, err
-	}
-	switch m[2] {
-	case "d":
-		return time.Duration(n) * 24 * time.Hour, nil
-	case "m":
-		return time.Duration(n) * 30 * 24 * time.Hour, nil
-	case "y":
-		return time.Duration(n) * 365 * 24 * time.Hour, nil
-	}
-	// should never happen, we already validated using regex
-	panic("unhandled period unit")
+func (s Spec) Lookback() Period {
+	p, _ := parsePeriod(s.LookbackStr) // any error should be caught by Validate()
+	return p
 }
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Period
+		wantErr bool
+	}{
+		{in: "7d", want: Period{Days: 7}},
+		{in: "2w", want: Period{Weeks: 2}},
+		{in: "3m", want: Period{Months: 3}},
+		{in: "1y", want: Period{Years: 1}},
+		{in: "1y6m", want: Period{Years: 1, Months: 6}},
+		{in: "1m2w3d", want: Period{Months: 1, Weeks: 2, Days: 3}},
+		{in: "0d", want: Period{}},
+		{in: "", wantErr: true},
+		{in: "d", wantErr: true},
+		{in: "1d1y", wantErr: true},
+		{in: "1d1d", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: " 1d", wantErr: true},
+		{in: "1h", wantErr: true},
+		{in: "99999999999y", wantErr: true},
+		{in: "9999999999999999999d", wantErr: true},
+		{in: "101y", wantErr: true},
+		{in: "99y99m", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.in, func(t *testing.T) {
+			got, err := parsePeriod(tc.in)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("parsePeriod(%q) = %+v, want error", tc.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePeriod(%q) returned unexpected error: %v", tc.in, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected period. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSpecStartTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		now      time.Time
+		timezone string
+		period   string
+		start    string
+		want     time.Time
+	}{
+		{
+			name:   "days are aligned to midnight",
+			now:    time.Date(2023, 3, 15, 17, 30, 0, 0, time.UTC),
+			period: "7d",
+			want:   time.Date(2023, 3, 8, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "weeks",
+			now:    time.Date(2023, 3, 15, 17, 30, 0, 0, time.UTC),
+			period: "2w",
+			want:   time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "months use calendar semantics",
+			now:    time.Date(2023, 5, 15, 1, 0, 0, 0, time.UTC),
+			period: "3m",
+			want:   time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "months are clamped to the end of the month",
+			now:    time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC),
+			period: "1m",
+			want:   time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "months are clamped to a leap day",
+			now:    time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC),
+			period: "1m",
+			want:   time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "days are subtracted after clamping",
+			now:    time.Date(2023, 3, 31, 12, 0, 0, 0, time.UTC),
+			period: "1m1d",
+			want:   time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "years across a leap day",
+			now:    time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+			period: "1y",
+			want:   time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "combined",
+			now:    time.Date(2023, 7, 20, 12, 0, 0, 0, time.UTC),
+			period: "1y6m1w2d",
+			want:   time.Date(2022, 1, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "midnight in the configured timezone",
+			now:      time.Date(2023, 3, 15, 23, 30, 0, 0, time.UTC), // already March 16th in Berlin
+			timezone: "Europe/Berlin",
+			period:   "1d",
+			want:     time.Date(2023, 3, 15, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:     "across a daylight saving time change",
+			now:      time.Date(2023, 3, 27, 12, 0, 0, 0, berlin),
+			timezone: "Europe/Berlin",
+			period:   "2d",
+			want:     time.Date(2023, 3, 25, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:     "start date is parsed in the configured timezone",
+			now:      time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC),
+			timezone: "Europe/Berlin",
+			start:    "2023-01-01",
+			want:     time.Date(2023, 1, 1, 0, 0, 0, 0, berlin),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(orig func() time.Time) { now = orig }(now)
+			now = func() time.Time { return tc.now }
+			s := Spec{
+				UserID:       "test",
+				APIKey:       "test",
+				Websites:     []WebsiteSpec{{Hostname: "test.com"}},
+				PeriodStr:    tc.period,
+				StartDateStr: tc.start,
+				Timezone:     tc.timezone,
+			}
+			if err := s.Validate(); err != nil {
+				t.Fatalf("unexpected validation error: %v", err)
+			}
+			s.SetDefaults()
+			if got := s.StartTime(); !got.Equal(tc.want) {
+				t.Errorf("unexpected start time. got: %v, want: %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSpecEndTime(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2023, 3, 15, 23, 30, 0, 0, time.UTC) }
+	s := Spec{Timezone: "Asia/Tokyo"}
+	s.SetDefaults()
+	if s.EndDateStr != "2023-03-16" {
+		t.Errorf("unexpected default end date. got: %s, want: %s", s.EndDateStr, "2023-03-16")
+	}
+	if got := s.EndTime(); got.Location().String() != "Asia/Tokyo" || got.Hour() != 0 {
+		t.Errorf("expected end time at midnight in Asia/Tokyo, got: %v", got)
+	}
+}
+
+func TestSpecValidateTimezone(t *testing.T) {
+	s := Spec{UserID: "test", APIKey: "test", Websites: []WebsiteSpec{{Hostname: "test.com"}}, Timezone: "Mars/Olympus_Mons"}
+	if err := s.Validate(); err == nil {
+		t.Error("expected error for unknown timezone, got nil")
+	}
+}
+
+func FuzzParsePeriod(f *testing.F) {
+	for _, s := range []string{"7d", "3m", "1y", "0d", "2w", "1y6m1w2d", "99999999999y", "100y", "", "1w", "-1d", " 1d", "1d\n"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := parsePeriod(s)
+		if err != nil {
+			return
+		}
+		if p.Years < 0 || p.Months < 0 || p.Weeks < 0 || p.Days < 0 {
+			t.Errorf("parsePeriod(%q) = %+v, want non-negative components", s, p)
+		}
+		ref := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		if start := p.Before(ref); start.After(ref) || start.Before(ref.AddDate(-101, 0, 0)) {
+			t.Errorf("period %q reaches back to %v from %v", s, start, ref)
+		}
+	})
+}
+
+func FuzzSpecValidate(f *testing.F) {
+	f.Add("2023-01-01", "2023-02-01", "", "test.com", "")
+	f.Add("", "", "7d", "test.com", "Europe/Berlin")
+	f.Add("", "", "99999999999y", "test.com", "UTC")
+	f.Add("2023-13-01", "not a date", "1x", "", "Local")
+	f.Fuzz(func(t *testing.T, start, end, period, hostname, timezone string) {
+		s := Spec{
+			UserID:       "test",
+			APIKey:       "test",
+			Websites:     []WebsiteSpec{{Hostname: hostname}},
+			StartDateStr: start,
+			EndDateStr:   end,
+			PeriodStr:    period,
+			Timezone:     timezone,
+		}
+		if err := s.Validate(); err != nil {
+			return
+		}
+		s.SetDefaults()
+		if s.StartDateStr != "" {
+			return
+		}
+		// a valid period must never result in a start time in the future
+		if st := s.StartTime(); st.After(time.Now()) {
+			t.Errorf("start time %v for period %q is in the future", st, period)
+		}
+	})
+}
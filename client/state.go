@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StartTime returns the time to start fetching data for the given table from, according to these priorities:
+// 1. start of a backfill of the table
+// 2. backend state, unless the website configuration changed and on_config_change is backfill
+// 3. start_time from plugin spec (which defaults to 2018)
+func (c *Client) StartTime(ctx context.Context, table string) (time.Time, error) {
+	start := c.Spec.StartTime()
+	if b := c.backfill(table); b != nil {
+		if b.StartDateStr != "" {
+			start, _ = parseDate(b.StartDateStr, now(), c.Spec.Location()) // any error should be caught by Validate()
+		}
+		c.Logger.Warn().Str("table", table).Time("start", start).Time("end", c.EndTime(table)).Msg("backfilling, ignoring cursor")
+		return start, nil
+	}
+	cur, err := c.loadCursor(ctx, table)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cur == nil {
+		return start, nil
+	}
+	c.Logger.Info().Str("table", table).Str("cursor", cur.Next).Msg("cursor found")
+	if c.configChanged(table, cur) {
+		switch c.Spec.OnConfigChange {
+		case ConfigChangeBackfill:
+			c.Logger.Warn().Str("table", table).Time("start", start).Msg("website configuration changed since the last sync, ignoring cursor to backfill from the start date")
+			return start, nil
+		case ConfigChangeKeep:
+			c.Logger.Debug().Str("table", table).Msg("website configuration changed since the last sync, resuming from cursor")
+		default:
+			c.Logger.Warn().Str("table", table).Msg("website configuration changed since the last sync, but rows synced before will not be updated. Set on_config_change to backfill to sync them again")
+		}
+	}
+	start, err = time.ParseInLocation(AllowedTimeLayout, cur.Next, c.Spec.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse cursor from backend: %w", err)
+	}
+	return start, nil
+}
+
+// HighWaterMark returns the highest added_unix of rows of the given table that do not need to be
+// synced again: the highest added_unix synced so far, minus the safety margin. It returns 0 if
+// all rows should be synced, e.g. because there is no cursor or the table is being backfilled.
+func (c *Client) HighWaterMark(ctx context.Context, table string) (uint64, error) {
+	cur, err := c.loadCursor(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	if cur == nil || c.backfill(table) != nil || (c.configChanged(table, cur) && c.Spec.OnConfigChange == ConfigChangeBackfill) {
+		return 0, nil
+	}
+	margin := uint64(c.Spec.SafetyMargin() / time.Second)
+	if cur.LastAddedUnix <= margin {
+		return 0, nil
+	}
+	return cur.LastAddedUnix - margin, nil
+}
+
+// configChanged reports whether the cursor of the table was saved with a different website
+// configuration. Cursors saved without a fingerprint are assumed to match.
+func (c *Client) configChanged(table string, cur *Cursor) bool {
+	return cur.Fingerprint != "" && cur.Fingerprint != c.fingerprint(table)
+}
+
+// loadCursor returns the cursor for the given table, or nil if there is none or no backend is configured.
+func (c *Client) loadCursor(ctx context.Context, table string) (*Cursor, error) {
+	if c.Backend == nil {
+		return nil, nil
+	}
+	value, err := c.Backend.Get(ctx, table, c.ID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cursor from backend: %w", err)
+	}
+	if value == "" {
+		return nil, nil
+	}
+	cur, err := ParseCursor(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cursor from backend: %w", err)
+	}
+	return cur, nil
+}
+
+// SaveCursor saves the cursor state for the given table to the backend, if one is configured.
+func (c *Client) SaveCursor(ctx context.Context, table string, p Progress) error {
+	c.run.setWindow(p.Start, p.End)
+	if c.Backend == nil {
+		return nil
+	}
+	// A backfill of a window must not move the cursor: back, or the next sync would download
+	// everything since the window again, nor forward, past data that was never synced. Only
+	// reset_cursor and backfills of the whole date range save it.
+	if b := c.backfill(table); b != nil && (b.KeepCursor || (b.bounded() && !c.Spec.ResetCursor)) {
+		c.Logger.Info().Str("table", table).Int64("rows", p.Rows).Msg("backfill complete, keeping cursor")
+		return nil
+	}
+	prev, err := c.loadCursor(ctx, table)
+	if err != nil {
+		// the previous cursor is only used for statistics, so it is fine to start over
+		c.Logger.Warn().Err(err).Str("table", table).Msg("ignoring invalid cursor")
+		prev = nil
+	}
+	if prev == nil {
+		prev = &Cursor{}
+	}
+	// We subtract the lookback (a day by default) from the end time to allow delayed data points
+	// to be fetched on the next sync. This will cause some duplicates, but
+	// allows us to guarantee at-least-once delivery. Duplicates can be removed
+	// by using overwrite-delete-stale write mode, by de-duplicating in queries,
+	// or by running a post-processing step.
+	cur := &Cursor{
+		Version:       CursorVersion,
+		Next:          c.Spec.Lookback().Before(p.End).Format(AllowedTimeLayout),
+		WindowStart:   p.Start.Format(AllowedTimeLayout),
+		WindowEnd:     p.End.Format(AllowedTimeLayout),
+		LastAddedUnix: prev.LastAddedUnix,
+		Fingerprint:   c.fingerprint(table),
+		Stats: CursorStats{
+			Syncs:     prev.Stats.Syncs + 1,
+			Rows:      p.Rows,
+			TotalRows: prev.Stats.TotalRows + p.Rows,
+			UpdatedAt: now().UTC(),
+		},
+	}
+	if p.LastAddedUnix > cur.LastAddedUnix {
+		cur.LastAddedUnix = p.LastAddedUnix
+	}
+	if err := c.Backend.Set(ctx, table, c.ID(), cur.String()); err != nil {
+		return fmt.Errorf("failed to save cursor to backend: %w", err)
+	}
+	c.Logger.Info().Str("table", table).Str("cursor", cur.Next).Int64("rows", p.Rows).Int64("skipped", p.Skipped).Msg("cursor updated")
+	return nil
+}
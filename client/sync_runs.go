@@ -0,0 +1,218 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/schema"
+)
+
+// SyncRun holds the statistics of a table resolver run for a website.
+type SyncRun struct {
+	// SyncStartedAt is the same for all runs of a sync, to tell syncs apart.
+	SyncStartedAt time.Time
+	ClientID      string
+	Account       string
+	Hostname      string
+	TableName     string
+
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	DurationSeconds float64
+
+	// Rows is the number of rows emitted into the table.
+	Rows int64
+	// WireBytes and DecodedBytes are the sizes of all export responses downloaded by the run.
+	WireBytes    int64
+	DecodedBytes int64
+
+	// WindowStart and WindowEnd are the dates of the synced window. They are only set for runs
+	// that completed and saved their cursor.
+	WindowStart *time.Time
+	WindowEnd   *time.Time
+
+	// CursorBefore and CursorAfter are the stored cursor before and after the run.
+	CursorBefore string
+	CursorAfter  string
+
+	Errors int64
+	Error  string
+}
+
+// syncRuns collects the runs of a sync. Runs are expected as soon as the multiplexer returns
+// their clients, which the SDK does for all tables before resolving any of them, so that
+// Wait can tell when all resolvers of the sync are done.
+type syncRuns struct {
+	startedAt time.Time
+
+	mu      sync.Mutex
+	runs    []*syncRun
+	pending int
+	done    chan struct{}
+}
+
+func newSyncRuns() *syncRuns {
+	return &syncRuns{startedAt: now().UTC(), done: make(chan struct{})}
+}
+
+// expect registers a run that has yet to be resolved.
+func (s *syncRuns) expect(c *Client, table string) *syncRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := &syncRun{parent: s, SyncRun: SyncRun{
+		SyncStartedAt: s.startedAt,
+		ClientID:      c.ID(),
+		Account:       c.Account,
+		Hostname:      c.Website.Hostname,
+		TableName:     table,
+	}}
+	s.runs = append(s.runs, r)
+	s.pending++
+	return r
+}
+
+func (s *syncRuns) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if s.pending == 0 {
+		close(s.done)
+	}
+}
+
+// wait blocks until all expected runs are finished and returns them, ordered by client and table.
+func (s *syncRuns) wait(ctx context.Context) ([]SyncRun, error) {
+	s.mu.Lock()
+	pending := s.pending
+	s.mu.Unlock()
+	if pending > 0 {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]SyncRun, 0, len(s.runs))
+	for _, r := range s.runs {
+		r.mu.Lock()
+		runs = append(runs, r.SyncRun)
+		r.mu.Unlock()
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].ClientID != runs[j].ClientID {
+			return runs[i].ClientID < runs[j].ClientID
+		}
+		return runs[i].TableName < runs[j].TableName
+	})
+	return runs, nil
+}
+
+// syncRun is a run in progress.
+type syncRun struct {
+	parent *syncRuns
+
+	wireBytes, decodedBytes atomic.Int64
+
+	mu sync.Mutex
+	SyncRun
+}
+
+// addTransfer records a downloaded export response. It is safe for concurrent use.
+func (r *syncRun) addTransfer(wire, decoded int64) {
+	if r == nil {
+		return
+	}
+	r.wireBytes.Add(wire)
+	r.decodedBytes.Add(decoded)
+}
+
+// setWindow records the synced window of a completed run.
+func (r *syncRun) setWindow(start, end time.Time) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.WindowStart, r.WindowEnd = &start, &end
+}
+
+// TrackSyncRun wraps a resolver of a table multiplexed with WebsiteMultiplex to record its
+// statistics for the simple_analytics_sync_runs table.
+func TrackSyncRun(resolver schema.TableResolver) schema.TableResolver {
+	return func(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+		c := meta.(*Client)
+		r := c.run
+		if r == nil {
+			return resolver(ctx, meta, parent, res)
+		}
+		defer r.parent.finish()
+		startedAt := now().UTC()
+		before := c.rawCursor(ctx, r.TableName)
+
+		// count the rows on their way to the SDK
+		var rows int64
+		inner := make(chan any)
+		forwarded := make(chan struct{})
+		go func() {
+			defer close(forwarded)
+			for v := range inner {
+				if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+					rows += int64(rv.Len())
+				} else {
+					rows++
+				}
+				res <- v
+			}
+		}()
+		err := resolver(ctx, meta, parent, inner)
+		close(inner)
+		<-forwarded
+
+		finishedAt := now().UTC()
+		after := c.rawCursor(ctx, r.TableName)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.StartedAt = startedAt
+		r.FinishedAt = finishedAt
+		r.DurationSeconds = finishedAt.Sub(startedAt).Seconds()
+		r.Rows = rows
+		r.WireBytes = r.wireBytes.Load()
+		r.DecodedBytes = r.decodedBytes.Load()
+		r.CursorBefore, r.CursorAfter = before, after
+		if err != nil {
+			r.Errors = 1
+			r.Error = err.Error()
+		}
+		return err
+	}
+}
+
+// rawCursor returns the cursor stored for the table as is, or an empty string if there is none
+// or it could not be read.
+func (c *Client) rawCursor(ctx context.Context, table string) string {
+	if c.Backend == nil {
+		return ""
+	}
+	value, err := c.Backend.Get(ctx, table, c.ID())
+	if err != nil {
+		c.Logger.Warn().Err(err).Str("table", table).Msg("failed to read cursor for sync run statistics")
+		return ""
+	}
+	return value
+}
+
+// WaitSyncRuns waits until the resolvers of all tables multiplexed with WebsiteMultiplex are done,
+// and returns their statistics. It must be called with a client returned by SyncRunsMultiplex, and
+// returns no runs for all but the last of them, which is resolved after all other tables are started.
+func (c *Client) WaitSyncRuns(ctx context.Context) ([]SyncRun, error) {
+	if c.syncRuns == nil || !c.collectsSyncRuns {
+		return nil, nil
+	}
+	return c.syncRuns.wait(ctx)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/specs"
+)
+
+func TestSyncRunsWait(t *testing.T) {
+	s := newSyncRuns()
+	a := s.expect(&Client{Website: WebsiteSpec{Hostname: "a.com"}}, "simple_analytics_page_views")
+	s.expect(&Client{Account: "b", Website: WebsiteSpec{Hostname: "b.com"}}, "simple_analytics_events")
+	a.addTransfer(10, 100)
+	a.setWindow(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected wait to time out while runs are pending, got: %v", err)
+	}
+
+	s.finish()
+	s.finish()
+	runs, err := s.wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ClientID != "simple-analytics:a.com" || runs[1].ClientID != "simple-analytics:b:b.com" {
+		t.Fatalf("unexpected runs: %+v", runs)
+	}
+	if runs[0].WindowStart == nil || runs[1].WindowStart != nil {
+		t.Errorf("expected only the first run to have a window, got %+v", runs)
+	}
+	if !runs[0].SyncStartedAt.Equal(runs[1].SyncStartedAt) {
+		t.Errorf("expected runs of a sync to share the sync start time")
+	}
+}
+
+// TestSchedulerOrder pins the behaviour of the SDK schedulers that SyncRunsMultiplex depends on:
+// all multiplexers are called before any table is resolved, and with a single table slot the
+// last client of the sync runs table, which comes last, is resolved after all other clients.
+// If an SDK upgrade breaks this, the sync runs table can hang the sync.
+func TestSchedulerOrder(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	defer ts.Close()
+	spec := Spec{UserID: "test", APIKey: "test", Websites: []WebsiteSpec{
+		{Hostname: "a.com"},
+		{Hostname: "b.com", Tables: []string{"test_first"}},
+		{Hostname: "c.com", Tables: []string{"test_second"}},
+	}}
+
+	for _, scheduler := range []specs.Scheduler{specs.SchedulerDFS, specs.SchedulerRoundRobin} {
+		t.Run(scheduler.String(), func(t *testing.T) {
+			var mu sync.Mutex
+			var calls []string
+			record := func(call string) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, call)
+			}
+			newTable := func(name string, multiplex func(schema.ClientMeta) []schema.ClientMeta) *schema.Table {
+				return &schema.Table{
+					Name:    name,
+					Columns: schema.ColumnList{{Name: "id", Type: schema.TypeString}},
+					Multiplex: func(meta schema.ClientMeta) []schema.ClientMeta {
+						record("multiplex")
+						return multiplex(meta)
+					},
+					Resolver: func(_ context.Context, meta schema.ClientMeta, _ *schema.Resource, _ chan<- any) error {
+						c := meta.(*Client)
+						record(fmt.Sprintf("resolve %s %s collects=%v", name, c.Website.Hostname, c.collectsSyncRuns))
+						return nil
+					},
+				}
+			}
+			tables := schema.Tables{
+				newTable("test_first", WebsiteMultiplex("test_first")),
+				newTable("test_second", WebsiteMultiplex("test_second")),
+				newTable("test_sync_runs", SyncRunsMultiplex),
+			}
+			TestSyncTables(t, tables, ts, spec, NewMemoryBackend(), func(src *specs.Source) {
+				src.Scheduler = scheduler
+				src.Concurrency = 1
+			})
+
+			if len(calls) != 3+7 {
+				t.Fatalf("expected 3 multiplexer calls and 7 resolver calls, got %q", calls)
+			}
+			for i, call := range calls {
+				if (i < 3) != (call == "multiplex") {
+					t.Fatalf("expected all multiplexers to be called before any resolver, got %q", calls)
+				}
+			}
+			if last := calls[len(calls)-1]; last != "resolve test_sync_runs c.com collects=true" {
+				t.Errorf("expected the collecting sync runs client to be resolved last, got %q", calls)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -22,14 +23,21 @@ func TestHelper(t *testing.T, table *schema.Table, ts *httptest.Server) {
 		zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.StampMicro},
 	).Level(zerolog.DebugLevel).With().Timestamp().Logger()
 	newTestExecutionClient := func(ctx context.Context, logger zerolog.Logger, spec specs.Source, opts source.Options) (schema.ClientMeta, error) {
-		saClient := simpleanalytics.NewClient("test", "test", simpleanalytics.WithBaseURL(ts.URL), simpleanalytics.WithHTTPClient(ts.Client()))
 		s := Spec{
-			UserID: "test",
-			APIKey: "test",
+			UserID:         "test",
+			APIKey:         "test",
+			ParseUserAgent: true,
 			Websites: []WebsiteSpec{
 				{
-					Hostname:       "test.com",
-					MetadataFields: []string{"metadata_text", "metadata_int"},
+					Hostname:         "test.com",
+					MetadataFields:   []string{"metadata_text", "metadata_int"},
+					ConversionEvents: []string{"signup"},
+					EventTables: []EventTableSpec{
+						{
+							Event:          "signup",
+							MetadataFields: []string{"plan_text", "seats_int", "trial_bool", "renews_date"},
+						},
+					},
 				},
 			},
 		}
@@ -39,10 +47,14 @@ func TestHelper(t *testing.T, table *schema.Table, ts *httptest.Server) {
 			return nil, err
 		}
 		return &Client{
-			Logger:   l,
-			SAClient: saClient,
-			Backend:  opts.Backend,
-			Spec:     s,
+			Logger:  l,
+			Backend: opts.Backend,
+			Spec:    s,
+
+			accounts:      newAccounts(s, simpleanalytics.WithBaseURL(ts.URL), simpleanalytics.WithHTTPClient(ts.Client())),
+			fieldWarnings: newFieldWarnings(),
+			syncRuns:      newSyncRuns(),
+			shared:        newShared(),
 		}, nil
 	}
 	p := source.NewPlugin(
@@ -61,3 +73,102 @@ func TestHelper(t *testing.T, table *schema.Table, ts *httptest.Server) {
 		Destinations: []string{"mock-destination"},
 	})
 }
+
+// MemoryBackend is an in-memory state backend for tests.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{values: make(map[string]string)}
+}
+
+func (b *MemoryBackend) Set(_ context.Context, table, clientID, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[table+":"+clientID] = value
+	return nil
+}
+
+func (b *MemoryBackend) Get(_ context.Context, table, clientID string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.values[table+":"+clientID], nil
+}
+
+func (*MemoryBackend) Close(context.Context) error {
+	return nil
+}
+
+// TestSync runs a single sync of the table created by newTable against ts, using the given plugin
+// spec and state backend, and returns the synced resources. Unlike TestHelper, it can be called
+// repeatedly with the same backend to test incremental syncs.
+func TestSync(t *testing.T, newTable func() *schema.Table, ts *httptest.Server, s Spec, b *MemoryBackend) []*schema.Resource {
+	t.Helper()
+	return TestSyncTables(t, schema.Tables{newTable()}, ts, s, b)
+}
+
+// TestSyncTables is like TestSync, but syncs several tables in the given order. The source spec
+// can be modified, e.g. to change the scheduler.
+func TestSyncTables(t *testing.T, tables schema.Tables, ts *httptest.Server, s Spec, b *MemoryBackend, opts ...func(*specs.Source)) []*schema.Resource {
+	t.Helper()
+	return TestSyncTablesContext(context.Background(), t, tables, ts, s, b, opts...)
+}
+
+// TestSyncTablesContext is like TestSyncTables, but stops the sync when ctx is done, e.g. to
+// catch syncs that hang. It must be called from the test goroutine.
+func TestSyncTablesContext(ctx context.Context, t *testing.T, tables schema.Tables, ts *httptest.Server, s Spec, b *MemoryBackend, opts ...func(*specs.Source)) []*schema.Resource {
+	t.Helper()
+	version := "vDev"
+	l := zerolog.New(zerolog.NewTestWriter(t)).Level(zerolog.DebugLevel).With().Timestamp().Logger()
+	newTestExecutionClient := func(ctx context.Context, logger zerolog.Logger, spec specs.Source, opts source.Options) (schema.ClientMeta, error) {
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		return &Client{
+			Logger:  l,
+			Backend: b,
+			Spec:    s,
+
+			accounts:      newAccounts(s, simpleanalytics.WithBaseURL(ts.URL), simpleanalytics.WithHTTPClient(ts.Client())),
+			fieldWarnings: newFieldWarnings(),
+			syncRuns:      newSyncRuns(),
+			shared:        newShared(),
+		}, nil
+	}
+	names := make([]string, 0, len(tables))
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	p := source.NewPlugin(names[0], version, tables, newTestExecutionClient)
+	p.SetLogger(l)
+	src := specs.Source{
+		Name:         "dev",
+		Path:         "cloudquery/dev",
+		Version:      version,
+		Tables:       names,
+		Destinations: []string{"mock-destination"},
+	}
+	for _, opt := range opts {
+		opt(&src)
+	}
+	if err := p.Init(ctx, src); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan *schema.Resource)
+	var syncErr error
+	go func() {
+		defer close(ch)
+		syncErr = p.Sync(ctx, ch)
+	}()
+	var resources []*schema.Resource
+	for r := range ch {
+		resources = append(resources, r)
+	}
+	if syncErr != nil {
+		t.Fatal(syncErr)
+	}
+	return resources
+}
@@ -0,0 +1,40 @@
+package client
+
+import "github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+
+// OnTransfer returns a callback for simpleanalytics.ExportOptions.OnTransfer that logs the size
+// of an export response on the wire and after decoding, and adds it to the sync run statistics.
+func (c *Client) OnTransfer(exportType string) func(simpleanalytics.TransferStats) {
+	return func(s simpleanalytics.TransferStats) {
+		SplitTransfer(exportType, s, []*Client{c})
+	}
+}
+
+// SplitTransfer logs the size of an export response read by the tables of the given clients, and
+// splits it evenly between their sync runs. The first client logs it and gets the remainder.
+func SplitTransfer(exportType string, s simpleanalytics.TransferStats, clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+	n := int64(len(clients))
+	for i, c := range clients {
+		wire, decoded := s.WireBytes/n, s.DecodedBytes/n
+		if i == 0 {
+			wire += s.WireBytes % n
+			decoded += s.DecodedBytes % n
+		}
+		c.run.addTransfer(wire, decoded)
+	}
+	encoding := s.Encoding
+	if encoding == "" {
+		encoding = "identity"
+	}
+	e := clients[0].Logger.Info().Str("type", exportType).Str("encoding", encoding).Int64("wire_bytes", s.WireBytes).Int64("decoded_bytes", s.DecodedBytes)
+	if s.WireBytes > 0 {
+		e = e.Float64("compression_ratio", float64(s.DecodedBytes)/float64(s.WireBytes))
+	}
+	if n > 1 {
+		e = e.Int64("tables", n)
+	}
+	e.Msg("export downloaded")
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError describes a single problem with the plugin spec.
+type ValidationError struct {
+	// Path is the JSON path of the offending field, e.g. "websites[2].hostname".
+	Path string
+	// Message describes the problem.
+	Message string
+	// Suggestion describes how to fix the problem, if there is an obvious fix.
+	Suggestion string
+}
+
+func (e ValidationError) Error() string {
+	msg := e.Path + ": " + e.Message
+	if e.Suggestion != "" {
+		msg += " (" + e.Suggestion + ")"
+	}
+	return msg
+}
+
+// ValidationErrors is the list of all problems found by Spec.Validate.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("%d problems found:", len(e)))
+	for _, err := range e {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationErrors) add(path, suggestion, format string, args ...any) {
+	*e = append(*e, ValidationError{Path: path, Message: fmt.Sprintf(format, args...), Suggestion: suggestion})
+}
+
+// err returns the errors as an error, or nil if there are none.
+func (e ValidationErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
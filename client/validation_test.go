@@ -0,0 +1,485 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpecValidate(t *testing.T) {
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC) }
+
+	valid := func() Spec {
+		return Spec{
+			UserID:   "test",
+			APIKey:   "test",
+			Websites: []WebsiteSpec{{Hostname: "test.com"}, {Hostname: "example.com"}},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(s *Spec)
+		want   ValidationErrors
+	}{
+		{
+			name:   "valid",
+			modify: func(s *Spec) {},
+		},
+		{
+			name: "valid with dates",
+			modify: func(s *Spec) {
+				s.StartDateStr = "2023-01-01"
+				s.EndDateStr = "today"
+			},
+		},
+		{
+			name: "valid with a one day window",
+			modify: func(s *Spec) {
+				s.StartDateStr = "yesterday"
+				s.EndDateStr = "yesterday"
+			},
+		},
+		{
+			name: "missing credentials",
+			modify: func(s *Spec) {
+				s.UserID = ""
+				s.APIKey = ""
+			},
+			want: ValidationErrors{
+				{Path: "user_id", Message: "user_id is required"},
+				{Path: "api_key", Message: "api_key is required"},
+			},
+		},
+		{
+			name:   "no websites",
+			modify: func(s *Spec) { s.Websites = nil },
+			want:   ValidationErrors{{Path: "websites", Message: "at least one website is required"}},
+		},
+		{
+			name:   "missing hostname",
+			modify: func(s *Spec) { s.Websites[1].Hostname = "" },
+			want:   ValidationErrors{{Path: "websites[1].hostname", Message: "every website entry must have a hostname"}},
+		},
+		{
+			name:   "hostname with scheme",
+			modify: func(s *Spec) { s.Websites[1].Hostname = "https://example.com" },
+			want: ValidationErrors{{
+				Path:       "websites[1].hostname",
+				Message:    `hostname "https://example.com" must not contain a scheme, path or query`,
+				Suggestion: `use "example.com" instead`,
+			}},
+		},
+		{
+			name:   "hostname with path",
+			modify: func(s *Spec) { s.Websites[0].Hostname = "test.com/blog?ref=1" },
+			want: ValidationErrors{{
+				Path:       "websites[0].hostname",
+				Message:    `hostname "test.com/blog?ref=1" must not contain a scheme, path or query`,
+				Suggestion: `use "test.com" instead`,
+			}},
+		},
+		{
+			name: "duplicate hostname",
+			modify: func(s *Spec) {
+				s.Websites = append(s.Websites, WebsiteSpec{Hostname: "Test.com"})
+			},
+			want: ValidationErrors{{
+				Path:       "websites[2].hostname",
+				Message:    `hostname "Test.com" is already configured`,
+				Suggestion: "merge it with websites[0]",
+			}},
+		},
+		{
+			name:   "invalid event pattern",
+			modify: func(s *Spec) { s.Websites[1].ExcludeEvents = []string{"ok_*", "[bad"} },
+			want: ValidationErrors{{
+				Path:       "websites[1].exclude_events[1]",
+				Message:    `invalid event pattern "[bad": syntax error in pattern`,
+				Suggestion: "see https://pkg.go.dev/path#Match for the supported syntax",
+			}},
+		},
+		{
+			name: "conflicting event tables",
+			modify: func(s *Spec) {
+				s.Websites[0].EventTables = []EventTableSpec{{Event: "sign-up"}, {Event: "sign_up"}, {}}
+			},
+			want: ValidationErrors{
+				{
+					Path:       "websites[0].event_tables[1].event",
+					Message:    `events "sign-up" and "sign_up" would both be routed to table simple_analytics_events_sign_up`,
+					Suggestion: "route only one of them to its own table",
+				},
+				{Path: "websites[0].event_tables[2].event", Message: "every event_tables entry must have an event"},
+			},
+		},
+		{
+			name:   "invalid timezone",
+			modify: func(s *Spec) { s.Timezone = "Mars/Olympus_Mons" },
+			want: ValidationErrors{{
+				Path:       "timezone",
+				Message:    "could not load timezone: unknown time zone Mars/Olympus_Mons",
+				Suggestion: `use an IANA time zone name like "UTC" or "Europe/Berlin"`,
+			}},
+		},
+		{
+			name:   "invalid duration",
+			modify: func(s *Spec) { s.PeriodStr = "7x" },
+			want: ValidationErrors{{
+				Path:       "duration",
+				Message:    "could not parse duration: invalid period",
+				Suggestion: `should be numbers followed by "y", "m", "w" or "d", in that order, e.g. "7d", "2w", "1m" or "1y6m"`,
+			}},
+		},
+		{
+			name: "duration and start_date",
+			modify: func(s *Spec) {
+				s.PeriodStr = "7d"
+				s.StartDateStr = "2023-01-01"
+			},
+			want: ValidationErrors{{
+				Path:       "duration",
+				Message:    "duration and start_date are mutually exclusive",
+				Suggestion: "remove either duration or start_date",
+			}},
+		},
+		{
+			name: "invalid dates",
+			modify: func(s *Spec) {
+				s.StartDateStr = "2023-02-30"
+				s.EndDateStr = "tomorrow"
+			},
+			want: ValidationErrors{
+				{Path: "start_date", Message: `could not parse start_date: invalid date "2023-02-30"`, Suggestion: dateHint},
+				{Path: "end_date", Message: `could not parse end_date: invalid date "tomorrow"`, Suggestion: dateHint},
+			},
+		},
+		{
+			name:   "end in the future",
+			modify: func(s *Spec) { s.EndDateStr = "today+1d" },
+			want: ValidationErrors{{
+				Path:       "end_date",
+				Message:    "end_date 2023-03-16 is in the future",
+				Suggestion: "omit end_date to sync up to today",
+			}},
+		},
+		{
+			name: "start after end",
+			modify: func(s *Spec) {
+				s.StartDateStr = "2023-03-01"
+				s.EndDateStr = "2023-02-01"
+			},
+			want: ValidationErrors{{
+				Path:       "start_date",
+				Message:    "start 2023-03-01 is after end 2023-02-01",
+				Suggestion: "start must not be after end_date",
+			}},
+		},
+		{
+			name: "duration reaching past end",
+			modify: func(s *Spec) {
+				s.PeriodStr = "7d"
+				s.EndDateStr = "2023-01-01"
+			},
+			want: ValidationErrors{{
+				Path:       "duration",
+				Message:    "start 2023-03-08 is after end 2023-01-01",
+				Suggestion: "start must not be after end_date",
+			}},
+		},
+		{
+			name: "valid website overrides",
+			modify: func(s *Spec) {
+				s.PeriodStr = "7d"
+				s.LookbackStr = "2d"
+				s.Websites[0].StartDateStr = "2019-01-01"
+				s.Websites[0].LookbackStr = "0d"
+				s.Websites[1].PeriodStr = "1m"
+				s.Websites[1].Tables = []string{"simple_analytics_events*"}
+			},
+		},
+		{
+			name: "invalid website overrides",
+			modify: func(s *Spec) {
+				s.Websites[1].StartDateStr = "2023-01-01"
+				s.Websites[1].PeriodStr = "1x"
+				s.Websites[1].EndDateStr = "today+1w"
+				s.Websites[1].LookbackStr = "1h"
+				s.Websites[1].Tables = []string{"[bad"}
+			},
+			want: ValidationErrors{
+				{
+					Path:       "websites[1].tables[0]",
+					Message:    `invalid table pattern "[bad": syntax error in pattern`,
+					Suggestion: "see https://pkg.go.dev/path#Match for the supported syntax",
+				},
+				{Path: "websites[1].duration", Message: "could not parse duration: invalid period", Suggestion: periodHint},
+				{Path: "websites[1].duration", Message: "duration and start_date are mutually exclusive", Suggestion: "remove either duration or start_date"},
+				{Path: "websites[1].end_date", Message: "end_date 2023-03-22 is in the future", Suggestion: "omit end_date to sync up to today"},
+				{Path: "websites[1].lookback", Message: "could not parse lookback: invalid period", Suggestion: periodHint},
+			},
+		},
+		{
+			name:   "invalid config change policy",
+			modify: func(s *Spec) { s.OnConfigChange = "reset" },
+			want:   ValidationErrors{{Path: "on_config_change", Message: `invalid policy "reset"`, Suggestion: `should be "backfill", "warn" or "keep"`}},
+		},
+		{
+			name: "valid files mode without credentials",
+			modify: func(s *Spec) {
+				s.Mode = ModeFiles
+				s.UserID, s.APIKey = "", ""
+				s.Websites[0].Files = "exports/test.com"
+				s.Websites[1].Files = "exports/*.csv.gz"
+			},
+		},
+		{
+			name: "invalid files options",
+			modify: func(s *Spec) {
+				s.Mode = ModeFiles
+				s.Websites[1].Files = "exports/[a-"
+			},
+			want: ValidationErrors{
+				{Path: "websites[0].files", Message: "files is required in files mode", Suggestion: "set it to a directory or a glob of export files"},
+				{Path: "websites[1].files", Message: `invalid files pattern "exports/[a-": syntax error in pattern`, Suggestion: "see https://pkg.go.dev/path/filepath#Match for the supported syntax"},
+			},
+		},
+		{
+			name:   "files outside of files mode",
+			modify: func(s *Spec) { s.Websites[0].Files = "exports" },
+			want:   ValidationErrors{{Path: "websites[0].files", Message: "files is only used in files mode", Suggestion: `set mode to "files" to read export files`}},
+		},
+		{
+			name:   "invalid mode",
+			modify: func(s *Spec) { s.Mode = "offline" },
+			want:   ValidationErrors{{Path: "mode", Message: `invalid mode "offline"`, Suggestion: `should be "api" or "files"`}},
+		},
+		{
+			name:   "invalid format",
+			modify: func(s *Spec) { s.Format = "json" },
+			want:   ValidationErrors{{Path: "format", Message: `invalid format "json"`, Suggestion: `should be "ndjson" or "csv"`}},
+		},
+		{
+			name:   "invalid safety margin",
+			modify: func(s *Spec) { s.SafetyMarginStr = "1d" },
+			want: ValidationErrors{{
+				Path:       "safety_margin",
+				Message:    `could not parse safety_margin: time: unknown unit "d" in duration "1d"`,
+				Suggestion: `should be a duration like "30m" or "2h"`,
+			}},
+		},
+		{
+			name:   "negative safety margin",
+			modify: func(s *Spec) { s.SafetyMarginStr = "-1h" },
+			want:   ValidationErrors{{Path: "safety_margin", Message: "safety_margin must not be negative", Suggestion: "use 0 to filter all rows synced before"}},
+		},
+		{
+			name: "valid backfill",
+			modify: func(s *Spec) {
+				s.ResetCursor = true
+				s.Backfill = []BackfillSpec{
+					{Website: "*.com", Table: "simple_analytics_events_*", StartDateStr: "2019-01-01", EndDateStr: "start_of_month-1d", KeepCursor: true},
+					{Account: "agency"},
+				}
+			},
+		},
+		{
+			name: "invalid backfill",
+			modify: func(s *Spec) {
+				s.Backfill = []BackfillSpec{
+					{Website: "[bad", StartDateStr: "2023-02-01", EndDateStr: "2023-01-01"},
+					{Table: "[bad", StartDateStr: "last year", EndDateStr: "today+1d"},
+				}
+			},
+			want: ValidationErrors{
+				{Path: "backfill[0].website", Message: `invalid website pattern "[bad": syntax error in pattern`, Suggestion: "see https://pkg.go.dev/path#Match for the supported syntax"},
+				{Path: "backfill[0].start", Message: "start 2023-02-01 is after end 2023-01-01", Suggestion: "start must not be after end"},
+				{Path: "backfill[1].table", Message: `invalid table pattern "[bad": syntax error in pattern`, Suggestion: "see https://pkg.go.dev/path#Match for the supported syntax"},
+				{Path: "backfill[1].start", Message: `could not parse start: invalid date "last year"`, Suggestion: dateHint},
+				{Path: "backfill[1].end", Message: "end 2023-03-16 is in the future", Suggestion: "omit end to sync up to the top-level end_date"},
+			},
+		},
+		{
+			name:   "invalid concurrency",
+			modify: func(s *Spec) { s.Concurrency = 100 },
+			want:   ValidationErrors{{Path: "concurrency", Message: "invalid concurrency 100", Suggestion: "use a value between 1 and 16"}},
+		},
+		{
+			name:   "invalid lookback",
+			modify: func(s *Spec) { s.LookbackStr = "-1d" },
+			want:   ValidationErrors{{Path: "lookback", Message: "could not parse lookback: invalid period", Suggestion: periodHint}},
+		},
+		{
+			name: "website start after inherited end",
+			modify: func(s *Spec) {
+				s.EndDateStr = "2023-02-01"
+				s.Websites[1].StartDateStr = "2023-03-01"
+			},
+			want: ValidationErrors{{
+				Path:       "websites[1].start_date",
+				Message:    "start 2023-03-01 is after end 2023-02-01",
+				Suggestion: "start must not be after end_date",
+			}},
+		},
+		{
+			name: "website end before inherited duration",
+			modify: func(s *Spec) {
+				s.PeriodStr = "7d"
+				s.Websites[0].EndDateStr = "2023-03-01"
+			},
+			want: ValidationErrors{{
+				Path:       "duration",
+				Message:    "start 2023-03-08 is after end 2023-03-01",
+				Suggestion: "start must not be after end_date",
+			}},
+		},
+		{
+			name: "website start_date replaces inherited duration",
+			modify: func(s *Spec) {
+				s.PeriodStr = "7d"
+				s.Websites[0].StartDateStr = "2023-01-01"
+			},
+		},
+		{
+			name: "valid accounts",
+			modify: func(s *Spec) {
+				s.Accounts = []AccountSpec{
+					{Name: "agency", UserID: "a", APIKey: "a", Websites: []WebsiteSpec{{Hostname: "test.com"}}},
+					{Name: "client_b.eu", UserID: "b", APIKey: "b", Websites: []WebsiteSpec{{Hostname: "b.com", PeriodStr: "1w"}}},
+				}
+			},
+		},
+		{
+			name: "invalid accounts",
+			modify: func(s *Spec) {
+				s.Accounts = []AccountSpec{
+					{Name: "agency", UserID: "a", Websites: []WebsiteSpec{{Hostname: "a.com"}, {Hostname: "A.com"}}},
+					{Name: "agency", UserID: "b", APIKey: "b"},
+					{Name: "client b", UserID: "c", APIKey: "c", Websites: []WebsiteSpec{{Hostname: "c.com", EndDateStr: "soon"}}},
+					{UserID: "d", APIKey: "d", Websites: []WebsiteSpec{{Hostname: "d.com"}}},
+				}
+			},
+			want: ValidationErrors{
+				{Path: "accounts[1].name", Message: `account name "agency" is already used`, Suggestion: "rename it or merge it with accounts[0]"},
+				{Path: "accounts[2].name", Message: `invalid account name "client b"`, Suggestion: "use only letters, digits, dots, dashes and underscores"},
+				{Path: "accounts[3].name", Message: "every account entry must have a name"},
+				{Path: "accounts[0].api_key", Message: "api_key is required"},
+				{Path: "accounts[0].websites[1].hostname", Message: `hostname "A.com" is already configured`, Suggestion: "merge it with accounts[0].websites[0]"},
+				{Path: "accounts[1].websites", Message: "at least one website is required"},
+				{Path: "accounts[2].websites[0].end_date", Message: `could not parse end_date: invalid date "soon"`, Suggestion: dateHint},
+			},
+		},
+		{
+			name: "top-level websites without credentials",
+			modify: func(s *Spec) {
+				s.UserID, s.APIKey = "", ""
+				s.Accounts = []AccountSpec{{Name: "a", UserID: "a", APIKey: "a", Websites: []WebsiteSpec{{Hostname: "a.com"}}}}
+			},
+			want: ValidationErrors{
+				{Path: "user_id", Message: "user_id is required"},
+				{Path: "api_key", Message: "api_key is required"},
+			},
+		},
+		{
+			name: "multiple problems are aggregated",
+			modify: func(s *Spec) {
+				s.APIKey = ""
+				s.Websites[1].Hostname = "test.com"
+				s.EndDateStr = "next week"
+			},
+			want: ValidationErrors{
+				{Path: "api_key", Message: "api_key is required"},
+				{Path: "websites[1].hostname", Message: `hostname "test.com" is already configured`, Suggestion: "merge it with websites[0]"},
+				{Path: "end_date", Message: `could not parse end_date: invalid date "next week"`, Suggestion: dateHint},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := valid()
+			tc.modify(&s)
+			err := s.Validate()
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected validation error: %v", err)
+				}
+				return
+			}
+			var got ValidationErrors
+			if !errors.As(err, &got) {
+				t.Fatalf("expected ValidationErrors, got: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected validation errors. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestSpecForWebsite(t *testing.T) {
+	s := Spec{StartDateStr: "2023-01-01", EndDateStr: "2023-03-01", LookbackStr: "1d"}
+	tests := []struct {
+		name string
+		w    WebsiteSpec
+		want Spec
+	}{
+		{
+			name: "no overrides",
+			w:    WebsiteSpec{Hostname: "test.com"},
+			want: s,
+		},
+		{
+			name: "duration replaces start_date",
+			w:    WebsiteSpec{PeriodStr: "7d", LookbackStr: "0d"},
+			want: Spec{PeriodStr: "7d", EndDateStr: "2023-03-01", LookbackStr: "0d"},
+		},
+		{
+			name: "start and end",
+			w:    WebsiteSpec{StartDateStr: "2019-01-01", EndDateStr: "yesterday"},
+			want: Spec{StartDateStr: "2019-01-01", EndDateStr: "yesterday", LookbackStr: "1d"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, s.forWebsite(tc.w)); diff != "" {
+				t.Errorf("unexpected spec. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestWebsiteSyncsTable(t *testing.T) {
+	w := WebsiteSpec{Tables: []string{"simple_analytics_page_views", "simple_analytics_events_*"}}
+	for table, want := range map[string]bool{
+		"simple_analytics_page_views":     true,
+		"simple_analytics_events_signup":  true,
+		"simple_analytics_events":         false,
+		"simple_analytics_sessions":       false,
+		"simple_analytics_page_views_old": false,
+	} {
+		if got := w.SyncsTable(table); got != want {
+			t.Errorf("SyncsTable(%q) = %v, want %v", table, got, want)
+		}
+	}
+	if !(WebsiteSpec{}).SyncsTable("simple_analytics_sessions") {
+		t.Error("expected all tables to be synced if tables is empty")
+	}
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	errs := ValidationErrors{
+		{Path: "api_key", Message: "api_key is required"},
+		{Path: "websites[2].hostname", Message: "hostname \"https://test.com\" must not contain a scheme, path or query", Suggestion: "use \"test.com\" instead"},
+	}
+	want := `2 problems found:
+  - api_key: api_key is required
+  - websites[2].hostname: hostname "https://test.com" must not contain a scheme, path or query (use "test.com" instead)`
+	if got := errs.Error(); got != want {
+		t.Errorf("unexpected error message. got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := errs[:1].Error(), "api_key: api_key is required"; got != want {
+		t.Errorf("unexpected error message. got: %s, want: %s", got, want)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/cloudquery/cq-source-simple-analytics
 go 1.19
 
 require (
+	github.com/andybalholm/brotli v1.0.4
 	github.com/cloudquery/plugin-sdk v1.29.0
 	github.com/google/go-cmp v0.5.9
 	github.com/rs/zerolog v1.28.0
@@ -0,0 +1,179 @@
+package simpleanalytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest in the archive directory. It has one JSON line per
+// archived response, as a ManifestEntry.
+const ManifestFile = "manifest.ndjson"
+
+// archiveTimeLayout is the layout of the fetch time in the names of archived responses.
+const archiveTimeLayout = "20060102T150405.000000000Z"
+
+// manifestMu serializes writes to manifests, which may be shared by several clients.
+var manifestMu sync.Mutex
+
+// ManifestEntry describes an archived response.
+type ManifestEntry struct {
+	// Path is the path of the archived response, relative to the archive directory.
+	Path      string    `json:"path"`
+	Hostname  string    `json:"hostname"`
+	Type      string    `json:"type"`
+	Start     string    `json:"start"`
+	End       string    `json:"end"`
+	Fields    []string  `json:"fields"`
+	Format    string    `json:"format"`
+	Version   string    `json:"version"`
+	FetchedAt time.Time `json:"fetched_at"`
+
+	// ContentEncoding is the Content-Encoding of the response, or empty if it was not compressed.
+	// The archived body is still encoded with it.
+	ContentEncoding string `json:"content_encoding"`
+
+	// Bytes and SHA256 are the size and hash of the response body as it was received, i.e. of
+	// the archived file.
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+
+	// Rows is the number of rows decoded from the response. Complete is false if the response
+	// could not be read or decoded completely, in which case the archive may be truncated and
+	// rows are not counted.
+	Rows     int  `json:"rows"`
+	Complete bool `json:"complete"`
+}
+
+// WithArchiveDir makes the client write the body of every successful export response to dir as
+// it is read. Bodies are stored exactly as they were received, before removing any content
+// encoding, as <hostname>/<type>/<start>/<fetched_at>.<format>[.gz|.br], and recorded in the
+// manifest.
+func WithArchiveDir(dir string) Option {
+	return func(c *Client) {
+		c.archiveDir = dir
+	}
+}
+
+// archive writes a response body to the archive directory while it is read.
+type archive struct {
+	dir   string
+	entry ManifestEntry
+	file  *os.File
+	hash  hash.Hash
+	err   error
+}
+
+// archiveExtensions are the file name extensions of archived bodies by content encoding.
+var archiveExtensions = map[string]string{"": "", "identity": "", "gzip": ".gz", "x-gzip": ".gz", "br": ".br"}
+
+func newArchive(dir string, query url.Values, encoding string, fetchedAt time.Time) (*archive, error) {
+	fetchedAt = fetchedAt.UTC()
+	format := query.Get("format")
+	var fields []string
+	if f := query.Get("fields"); f != "" {
+		fields = strings.Split(f, ",")
+	}
+	a := &archive{
+		dir: dir,
+		entry: ManifestEntry{
+			Hostname:  query.Get("hostname"),
+			Type:      query.Get("type"),
+			Start:     query.Get("start"),
+			End:       query.Get("end"),
+			Fields:    fields,
+			Format:    format,
+			Version:   query.Get("version"),
+			FetchedAt: fetchedAt,
+
+			ContentEncoding: encoding,
+		},
+		hash: sha256.New(),
+	}
+	partition := filepath.Join(a.entry.Hostname, a.entry.Type, a.entry.Start)
+	if err := os.MkdirAll(filepath.Join(dir, partition), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	ext, ok := archiveExtensions[strings.ToLower(strings.TrimSpace(encoding))]
+	if !ok {
+		ext = ".bin"
+	}
+	// never overwrite an archived response, even if another one was fetched at the same time
+	name := fetchedAt.Format(archiveTimeLayout)
+	for i := 1; ; i++ {
+		a.entry.Path = filepath.ToSlash(filepath.Join(partition, name+"."+format+ext))
+		f, err := os.OpenFile(filepath.Join(dir, a.entry.Path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			name = fmt.Sprintf("%s-%d", fetchedAt.Format(archiveTimeLayout), i)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create archive file: %w", err)
+		}
+		a.file = f
+		return a, nil
+	}
+}
+
+// Write archives p. Errors are kept until close, so that they do not interrupt the export.
+func (a *archive) Write(p []byte) (int, error) {
+	if a.err == nil {
+		a.hash.Write(p)
+		a.entry.Bytes += int64(len(p))
+		_, a.err = a.file.Write(p)
+	}
+	return len(p), nil
+}
+
+// close finishes the archive and records it in the manifest.
+func (a *archive) close(rows int, complete bool) error {
+	err := a.err
+	if ferr := a.file.Close(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive file %s: %w", a.entry.Path, err)
+	}
+	a.entry.SHA256 = hex.EncodeToString(a.hash.Sum(nil))
+	a.entry.Rows = rows
+	a.entry.Complete = complete
+	line, err := json.Marshal(a.entry)
+	if err != nil {
+		return err
+	}
+	manifestMu.Lock()
+	defer manifestMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(a.dir, ManifestFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open archive manifest: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	return f.Close()
+}
+
+// rowCounter counts the rows read from a rowReader.
+type rowCounter struct {
+	rows rowReader
+	n    int
+}
+
+func (c *rowCounter) next() ([]byte, error) {
+	b, err := c.rows.next()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
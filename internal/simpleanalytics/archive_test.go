@@ -0,0 +1,153 @@
+package simpleanalytics
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func readManifest(t *testing.T, dir string) []ManifestEntry {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestExportArchive(t *testing.T) {
+	contents, err := os.ReadFile("testdata/pageviews.ndjson")
+	if err != nil {
+		t.Fatalf("unexpected error reading testdata file: %v", err)
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(contents)
+	zw.Close()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("hostname") {
+		case "error.com":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "invalid.com":
+			w.Write([]byte("{\"uuid\":\"1\"}\nnot json\n"))
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed.Bytes())
+		}
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	c := NewClient(testUserID, testAPIKey, WithBaseURL(ts.URL), WithHTTPClient(ts.Client()), WithArchiveDir(dir))
+	opts := ExportOptions{
+		Hostname: testHostname,
+		Start:    time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC),
+		Fields:   []string{"uuid", "added_iso"},
+	}
+	testExportPageViews(t, c, opts)
+	for _, host := range []string{"error.com", "invalid.com"} {
+		opts := opts
+		opts.Hostname = host
+		if err := c.ExportPageViews(context.Background(), opts, make(chan PageView, 10)); err == nil {
+			t.Fatalf("expected error exporting %s, got nil", host)
+		}
+	}
+
+	entries := readManifest(t, dir)
+	sum := sha256.Sum256(compressed.Bytes())
+	want := []ManifestEntry{
+		{
+			Hostname: testHostname,
+			Type:     "pageviews",
+			Start:    "2022-12-01",
+			End:      "2023-01-31",
+			Fields:   []string{"uuid", "added_iso"},
+			Format:   "ndjson",
+			Version:  "5",
+			Bytes:    int64(compressed.Len()),
+			SHA256:   hex.EncodeToString(sum[:]),
+			Rows:     3,
+			Complete: true,
+
+			ContentEncoding: "gzip",
+		},
+		{
+			Hostname: "invalid.com",
+			Type:     "pageviews",
+			Start:    "2022-12-01",
+			End:      "2023-01-31",
+			Fields:   []string{"uuid", "added_iso"},
+			Format:   "ndjson",
+			Version:  "5",
+		},
+	}
+	if diff := cmp.Diff(want, entries, cmpopts.IgnoreFields(ManifestEntry{}, "Path", "FetchedAt", "Bytes", "SHA256")); diff != "" {
+		t.Fatalf("unexpected manifest. diff: %s", diff)
+	}
+	if entries[0].Bytes != want[0].Bytes || entries[0].SHA256 != want[0].SHA256 {
+		t.Errorf("unexpected size or hash of archived response: %d bytes, sha256 %s", entries[0].Bytes, entries[0].SHA256)
+	}
+	if !strings.HasPrefix(entries[0].Path, testHostname+"/pageviews/2022-12-01/") || !strings.HasSuffix(entries[0].Path, ".ndjson.gz") {
+		t.Errorf("unexpected archive path %s", entries[0].Path)
+	}
+	if !strings.HasSuffix(entries[1].Path, ".ndjson") {
+		t.Errorf("unexpected archive path %s for an uncompressed response", entries[1].Path)
+	}
+
+	archived, err := os.ReadFile(filepath.Join(dir, entries[0].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(archived, compressed.Bytes()) {
+		t.Errorf("archived response differs from the response body as received")
+	}
+}
+
+func TestArchiveDoesNotOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	query := getQueryParams(ExportOptions{Hostname: testHostname, Start: time.Now(), End: time.Now()})
+	query.Set("type", "events")
+	fetchedAt := time.Now()
+	paths := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		a, err := newArchive(dir, query, "", fetchedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Write([]byte("{}\n"))
+		if err := a.close(1, true); err != nil {
+			t.Fatal(err)
+		}
+		paths[a.entry.Path] = true
+	}
+	if len(paths) != 3 {
+		t.Errorf("expected 3 distinct archive files, got %v", paths)
+	}
+	if n := len(readManifest(t, dir)); n != 3 {
+		t.Errorf("expected 3 manifest entries, got %d", n)
+	}
+}
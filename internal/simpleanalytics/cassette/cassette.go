@@ -0,0 +1,276 @@
+// Package cassette implements an http.RoundTripper that records HTTP interactions to a
+// cassette file and replays them offline, for fixture-based regression tests.
+//
+// Credentials are scrubbed from recorded requests, so cassettes can be committed to the
+// repository. A cassette is a JSON file, gzip-compressed if its name ends with ".gz".
+//
+// Typical usage with the Simple Analytics client:
+//
+//	rec, err := cassette.New("testdata/cassettes/export.json.gz", cassette.ModeReplay)
+//	...
+//	c := simpleanalytics.NewClient(userID, apiKey, simpleanalytics.WithHTTPClient(rec.Client()))
+package cassette
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics/contentencoding"
+)
+
+// Mode is the mode a Recorder operates in.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the underlying transport and records them.
+	ModeRecord
+)
+
+// Version is the version of the cassette file format.
+const Version = 1
+
+const redacted = "REDACTED"
+
+// scrubHeaders are replaced with a placeholder before interactions are recorded.
+var scrubHeaders = []string{"User-Id", "Api-Key", "Authorization", "Cookie", "Set-Cookie"}
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+}
+
+// Recorder records or replays HTTP interactions. It is safe for concurrent use.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to make real requests in record mode.
+// Defaults to http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// New returns a recorder for the cassette at path. In replay mode, the cassette must exist.
+// In record mode, any existing cassette is overwritten when Save is called.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		cassette:  Cassette{Version: Version},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = *c
+		r.used = make([]bool, len(c.Interactions))
+	}
+	return r, nil
+}
+
+// Client returns an HTTP client that uses the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == ModeRecord {
+		return r.record(req)
+	}
+	return r.replay(req)
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+
+	// Bodies are stored decoded, so that cassettes stay readable and can be replayed to clients
+	// regardless of the encodings they accept.
+	header := scrub(resp.Header)
+	dec, err := contentencoding.NewReader(bytes.NewReader(raw), resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    requestKey(req),
+			Header: scrub(req.Header),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     header,
+			Body:       string(body),
+		},
+	})
+	return resp, nil
+}
+
+// replay returns the first unused interaction matching the request's method, path and query.
+// Once all matching interactions have been used, the last one is returned again.
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	key := requestKey(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	match := -1
+	for i, in := range r.cassette.Interactions {
+		if in.Request.Method != req.Method || in.Request.URL != key {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("cassette %s has no recorded interaction for %s %s", r.path, req.Method, key)
+	}
+	r.used[match] = true
+	in := r.cassette.Interactions[match]
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+		StatusCode:    in.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        in.Response.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+		ContentLength: int64(len(in.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return errors.New("cassette can only be saved in record mode")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.cassette); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if strings.HasSuffix(r.path, ".gz") {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(b); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		b = zbuf.Bytes()
+	}
+	return os.WriteFile(r.path, b, 0o644)
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer f.Close()
+	var rd io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress cassette: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	var c Cassette
+	if err := json.NewDecoder(rd).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette: %w", err)
+	}
+	if c.Version != Version {
+		return nil, fmt.Errorf("unsupported cassette version %d (want %d)", c.Version, Version)
+	}
+	return &c, nil
+}
+
+// requestKey identifies a request independently of the host, so cassettes recorded against
+// the real API can be replayed with any base URL. Query parameters are sorted by url.Values.Encode.
+func requestKey(req *http.Request) string {
+	q := req.URL.Query().Encode()
+	if q == "" {
+		return req.URL.Path
+	}
+	return req.URL.Path + "?" + q
+}
+
+func scrub(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range scrubHeaders {
+		if h.Get(k) != "" {
+			h.Set(k, redacted)
+		}
+	}
+	return h
+}
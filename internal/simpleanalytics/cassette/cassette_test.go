@@ -0,0 +1,148 @@
+package cassette
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	for _, name := range []string{"cassette.json", "cassette.json.gz"} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.Write([]byte(`{"type":"` + r.URL.Query().Get("type") + `"}` + "\n"))
+			}))
+			defer ts.Close()
+			path := filepath.Join(t.TempDir(), name)
+
+			rec, err := New(path, ModeRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, typ := range []string{"pageviews", "events"} {
+				if got := get(t, rec.Client(), ts.URL+"/api/export/datapoints?type="+typ+"&hostname=test.com"); got != `{"type":"`+typ+`"}`+"\n" {
+					t.Errorf("unexpected recorded body: %q", got)
+				}
+			}
+			if err := rec.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Interactions) != 2 {
+				t.Fatalf("expected 2 interactions, got %d", len(c.Interactions))
+			}
+
+			// Replay against a different host with reordered query parameters.
+			ts.Close()
+			rep, err := New(path, ModeReplay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := get(t, rep.Client(), "https://simpleanalytics.com/api/export/datapoints?hostname=test.com&type=events"); got != `{"type":"events"}`+"\n" {
+				t.Errorf("unexpected replayed body: %q", got)
+			}
+			req, _ := http.NewRequest(http.MethodGet, "https://simpleanalytics.com/api/export/datapoints?type=unknown", nil)
+			if _, err := rep.RoundTrip(req); err == nil {
+				t.Error("expected error for request without recorded interaction, got nil")
+			}
+		})
+	}
+}
+
+func TestScrubbedFileContainsNoSecrets(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/export/datapoints", nil)
+	req.Header.Set("User-Id", "sa_user_id_secret")
+	req.Header.Set("Api-Key", "sa_api_key_secret")
+	resp, err := rec.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Errorf("cassette contains credentials: %s", b)
+	}
+	if !strings.Contains(string(b), redacted) {
+		t.Errorf("expected credentials to be replaced with %s: %s", redacted, b)
+	}
+}
+
+func TestRecordStoresDecodedBody(t *testing.T) {
+	const body = `{"type":"pageviews"}` + "\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(body))
+		zw.Close()
+	}))
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Setting Accept-Encoding explicitly disables transparent decompression by the transport,
+	// as the API client does.
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/export/datapoints", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := rec.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("expected recorded response to be passed through encoded, got Content-Encoding %q", got)
+	}
+	resp.Body.Close()
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.Interactions[0].Response
+	if got.Body != body {
+		t.Errorf("unexpected stored body: got %q, want %q", got.Body, body)
+	}
+	if enc := got.Header.Get("Content-Encoding"); enc != "" {
+		t.Errorf("expected Content-Encoding to be removed from stored headers, got %q", enc)
+	}
+}
+
+func get(t *testing.T, c *http.Client, uri string) string {
+	t.Helper()
+	resp, err := c.Get(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
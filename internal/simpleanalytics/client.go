@@ -1,18 +1,23 @@
 package simpleanalytics
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics/contentencoding"
 )
 
 type Client struct {
-	userID  string
-	apiKey  string
-	baseURL string
-	client  *http.Client
+	userID     string
+	apiKey     string
+	baseURL    string
+	client     *http.Client
+	archiveDir string
 }
 
 const defaultURL = "https://simpleanalytics.com"
@@ -55,7 +60,104 @@ func (e HTTPError) Error() string {
 	return fmt.Sprintf("status %d (%v)", e.Code, http.StatusText(e.Code))
 }
 
-func (c *Client) get(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+// TransferStats describes the size of a response body before and after decoding.
+type TransferStats struct {
+	// Encoding is the content encoding of the response, or empty if it was not compressed.
+	Encoding     string
+	WireBytes    int64
+	DecodedBytes int64
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseBody is a response body that is decoded while it is read, counting bytes on both sides.
+type responseBody struct {
+	raw      io.ReadCloser
+	decoder  io.ReadCloser
+	wire     *countingReader
+	decoded  *countingReader
+	encoding string
+	archive  *archive
+}
+
+// newResponseBody returns the body of r. If a is not nil, the body is written to it as it is
+// received, before it is decoded.
+func newResponseBody(r *http.Response, a *archive) (*responseBody, error) {
+	var raw io.Reader = r.Body
+	if a != nil {
+		raw = io.TeeReader(r.Body, a)
+	}
+	wire := &countingReader{r: raw}
+	encoding := r.Header.Get("Content-Encoding")
+	decoder, err := contentencoding.NewReader(wire, encoding)
+	if err != nil {
+		r.Body.Close()
+		return nil, err
+	}
+	return &responseBody{
+		raw:      r.Body,
+		decoder:  decoder,
+		wire:     wire,
+		decoded:  &countingReader{r: decoder},
+		encoding: encoding,
+		archive:  a,
+	}, nil
+}
+
+// errorMessage returns the body of an error response, decoded if possible. Error bodies may be
+// empty or not encoded as announced, in which case they are returned as is.
+func errorMessage(r *http.Response) string {
+	raw, _ := io.ReadAll(r.Body)
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+		if decoder, err := contentencoding.NewReader(bytes.NewReader(raw), encoding); err == nil {
+			defer decoder.Close()
+			if msg, err := io.ReadAll(decoder); err == nil {
+				return string(msg)
+			}
+		}
+	}
+	return string(raw)
+}
+
+func (b *responseBody) Read(p []byte) (int, error) {
+	return b.decoded.Read(p)
+}
+
+// finish records the archived response, if any, as complete with the given number of rows.
+func (b *responseBody) finish(rows int) error {
+	if b.archive == nil {
+		return nil
+	}
+	a := b.archive
+	b.archive = nil
+	return a.close(rows, true)
+}
+
+func (b *responseBody) Close() error {
+	if b.archive != nil {
+		// the export failed, so the archive may be truncated; the export error takes precedence
+		_ = b.archive.close(0, false)
+		b.archive = nil
+	}
+	b.decoder.Close()
+	return b.raw.Close()
+}
+
+func (b *responseBody) stats() TransferStats {
+	return TransferStats{Encoding: b.encoding, WireBytes: b.wire.n, DecodedBytes: b.decoded.n}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*responseBody, error) {
 	uri := fmt.Sprintf("%s?%s", c.baseURL+path, query.Encode())
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
 	if err != nil {
@@ -64,14 +166,31 @@ func (c *Client) get(ctx context.Context, path string, query url.Values) (io.Rea
 	req.Header.Set("User-Id", c.userID)
 	req.Header.Set("Api-Key", c.apiKey)
 	req.Header.Set("Content-Type", "application/x-ndjson")
+	// Setting Accept-Encoding disables the transparent gzip decoding of http.Transport,
+	// so that we can support brotli as well, and count the bytes on the wire.
+	req.Header.Set("Accept-Encoding", contentencoding.Accept)
 	r, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if r.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(r.Body)
-		r.Body.Close()
-		return nil, HTTPError{Code: r.StatusCode, Message: string(body)}
+		defer r.Body.Close()
+		return nil, HTTPError{Code: r.StatusCode, Message: errorMessage(r)}
+	}
+	var a *archive
+	if c.archiveDir != "" {
+		if a, err = newArchive(c.archiveDir, query, r.Header.Get("Content-Encoding"), time.Now()); err != nil {
+			r.Body.Close()
+			return nil, err
+		}
+	}
+	body, err := newResponseBody(r, a)
+	if err != nil {
+		if a != nil {
+			// e.g. an unsupported encoding; whatever was read is archived as incomplete
+			_ = a.close(0, false)
+		}
+		return nil, err
 	}
-	return r.Body, nil
+	return body, nil
 }
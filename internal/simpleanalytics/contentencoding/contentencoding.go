@@ -0,0 +1,34 @@
+// Package contentencoding decodes compressed HTTP response bodies. It is shared by the API client
+// and the cassette recorder, which stores decoded bodies.
+package contentencoding
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Accept is the value of the Accept-Encoding request header for the supported encodings.
+const Accept = "gzip, br"
+
+// NewReader returns a reader decoding r according to the value of the Content-Encoding
+// response header. Decoding is streaming, so r is read as the returned reader is read.
+func NewReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode gzip response: %w", err)
+		}
+		return zr, nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
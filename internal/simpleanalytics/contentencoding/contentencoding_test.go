@@ -0,0 +1,62 @@
+package contentencoding
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNewReader(t *testing.T) {
+	const body = `{"uuid":"1"}` + "\n"
+	encode := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+	tests := []struct {
+		encoding string
+		codec    string
+	}{
+		{encoding: ""},
+		{encoding: "identity"},
+		{encoding: "gzip", codec: "gzip"},
+		{encoding: "x-gzip", codec: "gzip"},
+		{encoding: " GZIP ", codec: "gzip"},
+		{encoding: "br", codec: "br"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+			if tc.codec == "" {
+				buf.WriteString(body)
+			} else {
+				w := encode[tc.codec](&buf)
+				w.Write([]byte(body))
+				w.Close()
+			}
+			r, err := NewReader(&buf, tc.encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != body {
+				t.Errorf("got %q, want %q", got, body)
+			}
+		})
+	}
+}
+
+func TestNewReaderErrors(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil), "deflate"); err == nil {
+		t.Error("expected error for unsupported encoding, got nil")
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("not gzip")), "gzip"); err == nil {
+		t.Error("expected error for invalid gzip body, got nil")
+	}
+}
@@ -0,0 +1,116 @@
+package simpleanalytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// csvReader reads CSV rows with a header of field names, converting each row to a JSON object
+// so it can be decoded like an NDJSON row.
+//
+// CSV values are untyped, so they are converted according to the type of the struct field they
+// map to. Empty values are null. Metadata values are converted according to the suffix of their
+// name, as set by Simple Analytics: "_bool" to booleans, "_int" to numbers, and anything else to
+// strings. Values of unknown fields are kept as strings.
+type csvReader struct {
+	r          *csv.Reader
+	fieldTypes map[string]reflect.Type
+	header     []string
+	line       int
+}
+
+func newCSVReader(r io.Reader, fieldTypes map[string]reflect.Type) *csvReader {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+	return &csvReader{r: cr, fieldTypes: fieldTypes}
+}
+
+func (r *csvReader) next() ([]byte, error) {
+	if r.header == nil {
+		header, err := r.r.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		r.header = make([]string, len(header))
+		copy(r.header, header)
+		// exports downloaded from the dashboard may start with a byte order mark
+		r.header[0] = strings.TrimPrefix(r.header[0], "\ufeff")
+	}
+	record, err := r.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data points: %w", err)
+	}
+	line, _ := r.r.FieldPos(0)
+	row := make(map[string]any, len(record))
+	for i, s := range record {
+		k := r.header[i]
+		v, err := r.value(k, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s on CSV line %d: %w", k, line, err)
+		}
+		row[k] = v
+	}
+	b, err := json.Marshal(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode CSV line %d: %w", line, err)
+	}
+	return b, nil
+}
+
+// value converts the CSV value s of field k to a value with the JSON type of the field.
+func (r *csvReader) value(k, s string) (any, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(k, "metadata.") {
+		return metadataValue(k, s), nil
+	}
+	t, ok := r.fieldTypes[k]
+	if !ok {
+		return s, nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			err = fmt.Errorf("%q is not a finite number", s)
+		}
+		return f, err
+	default:
+		return s, nil
+	}
+}
+
+// metadataValue converts a metadata value according to the suffix of its name. Values that
+// cannot be converted are kept as strings.
+func metadataValue(name, s string) any {
+	switch {
+	case strings.HasSuffix(name, "_bool"):
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case strings.HasSuffix(name, "_int"):
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	}
+	return s
+}
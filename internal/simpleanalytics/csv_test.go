@@ -0,0 +1,137 @@
+package simpleanalytics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestExportCSV checks that the CSV testdata, converted from the NDJSON testdata, decodes to the same values.
+func TestExportCSV(t *testing.T) {
+	var gotFormats []string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		gotFormats = append(gotFormats, q.Get("format"))
+		contents, err := os.ReadFile("testdata/" + q.Get("type") + "." + q.Get("format"))
+		if err != nil {
+			t.Errorf("unexpected error reading testdata file: %v", err)
+		}
+		w.Write(contents)
+	}))
+	defer ts.Close()
+	c := NewClient(testUserID, testAPIKey, WithBaseURL(ts.URL), WithHTTPClient(ts.Client()))
+	opts := ExportOptions{
+		Hostname: testHostname,
+		Start:    time.Now().AddDate(0, -1, 0),
+		End:      time.Now(),
+	}
+	csvOpts := opts
+	csvOpts.Format = FormatCSV
+
+	wantPageViews := testExportPageViews(t, c, opts)
+	if diff := cmp.Diff(wantPageViews, testExportPageViews(t, c, csvOpts)); diff != "" {
+		t.Errorf("CSV page views differ from NDJSON page views. diff: %s", diff)
+	}
+	wantEvents := testExportEvents(t, c, opts)
+	if diff := cmp.Diff(wantEvents, testExportEvents(t, c, csvOpts)); diff != "" {
+		t.Errorf("CSV events differ from NDJSON events. diff: %s", diff)
+	}
+	if diff := cmp.Diff([]string{"ndjson", "csv", "ndjson", "csv"}, gotFormats); diff != "" {
+		t.Errorf("unexpected requested formats. diff: %s", diff)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []PageView
+		wantErr string
+	}{
+		{
+			name: "empty",
+			csv:  "",
+		},
+		{
+			name: "header only",
+			csv:  "uuid,hostname\n",
+		},
+		{
+			name: "byte order mark, quoting and nulls",
+			csv:  "\ufeffuuid,path,is_unique,duration_seconds,screen_width\n1,\"/a,b\",true,,1920\n",
+			want: []PageView{{UUID: "1", Path: "/a,b", IsUnique: true, ScreenWidth: 1920}},
+		},
+		{
+			name: "metadata and extra fields",
+			csv:  "uuid,metadata.plan_text,metadata.seats_int,metadata.trial_bool,metadata.bad_int,metadata.empty_text,new_field\n1,123,5,false,many,,42\n",
+			want: []PageView{{
+				UUID: "1",
+				Metadata: map[string]any{
+					"plan_text":  "123",
+					"seats_int":  5.0,
+					"trial_bool": false,
+					"bad_int":    "many",
+				},
+				ExtraFields: map[string]any{"new_field": "42"},
+			}},
+		},
+		{
+			name:    "invalid number",
+			csv:     "uuid,screen_width\n1,wide\n",
+			wantErr: "invalid value for screen_width on CSV line 2",
+		},
+		{
+			name:    "non-finite number",
+			csv:     "uuid,duration_seconds\n1,NaN\n",
+			wantErr: "invalid value for duration_seconds on CSV line 2",
+		},
+		{
+			name:    "wrong number of fields",
+			csv:     "uuid,path\n1\n",
+			wantErr: "wrong number of fields",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := make(chan PageView, 10)
+			d := newRowDecoder(knownFieldsPageViews, nil)
+			err := decodePageViews(newCSVReader(strings.NewReader(tc.csv), fieldTypesPageViews), d, out)
+			close(out)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []PageView
+			for v := range out {
+				got = append(got, v)
+			}
+			for i := range tc.want {
+				if tc.want[i].Metadata == nil {
+					tc.want[i].Metadata = map[string]any{}
+				}
+				if tc.want[i].ExtraFields == nil {
+					tc.want[i].ExtraFields = map[string]any{}
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected page views. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	if _, err := newRowReader(strings.NewReader(""), "xml", fieldTypesPageViews); err == nil {
+		t.Error("expected error for unsupported format, got nil")
+	}
+}
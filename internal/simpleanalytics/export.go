@@ -2,10 +2,14 @@ package simpleanalytics
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 )
@@ -89,6 +93,7 @@ type Event struct {
 	Datapoint        string         `json:"datapoint"`
 	DeviceType       string         `json:"device_type"`
 	DocumentReferrer string         `json:"document_referrer"`
+	ExtraFields      map[string]any `json:"-"`
 	Hostname         string         `json:"hostname"`
 	HostnameOriginal string         `json:"hostname_original"`
 	IsRobot          bool           `json:"is_robot"`
@@ -123,6 +128,7 @@ type PageView struct {
 	DeviceType         string         `json:"device_type"`
 	DocumentReferrer   string         `json:"document_referrer"`
 	DurationSeconds    float64        `json:"duration_seconds"`
+	ExtraFields        map[string]any `json:"-"`
 	Hostname           string         `json:"hostname"`
 	HostnameOriginal   string         `json:"hostname_original"`
 	IsRobot            bool           `json:"is_robot"`
@@ -150,12 +156,32 @@ type PageView struct {
 	ViewportWidth      int64          `json:"viewport_width"`
 }
 
+// Format is the format of an export.
+type Format string
+
+const (
+	// FormatNDJSON is newline-delimited JSON, with one object per row.
+	FormatNDJSON Format = "ndjson"
+	// FormatCSV is comma-separated values, with a header row of field names.
+	FormatCSV Format = "csv"
+)
+
 // ExportOptions sets options for the export method
 type ExportOptions struct {
 	Hostname string
 	Start    time.Time
 	End      time.Time
 	Fields   []string
+
+	// Format is the format the export is requested and decoded in. Defaults to FormatNDJSON.
+	Format Format
+
+	// OnFieldDrift, if set, is called once the export is complete if the response contained
+	// fields that are not mapped to struct fields, or lacked fields that were requested.
+	OnFieldDrift func(unexpected, missing []string)
+
+	// OnTransfer, if set, is called once the export is complete with the size of the response.
+	OnTransfer func(TransferStats)
 }
 
 // ExportPageViews returns all page views for the given time range
@@ -171,26 +197,41 @@ func (c *Client) ExportPageViews(ctx context.Context, opts ExportOptions, out ch
 		return fmt.Errorf("failed to export data points: %w", err)
 	}
 	defer reader.Close()
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		var v PageView
-		b := scanner.Bytes()
-		if err := json.Unmarshal(b, &v); err != nil {
-			return fmt.Errorf("failed to decode JSON: %w", err)
+	rows, err := newRowReader(reader, opts.Format, fieldTypesPageViews)
+	if err != nil {
+		return err
+	}
+	d := newRowDecoder(knownFieldsPageViews, opts.Fields)
+	counted := &rowCounter{rows: rows}
+	if err := decodePageViews(counted, d, out); err != nil {
+		return err
+	}
+	if err := reader.finish(counted.n); err != nil {
+		return err
+	}
+	d.reportDrift(opts.OnFieldDrift)
+	if opts.OnTransfer != nil {
+		opts.OnTransfer(reader.stats())
+	}
+	return nil
+}
+
+// decodePageViews decodes pageViews from rows.
+func decodePageViews(rows rowReader, d *rowDecoder, out chan<- PageView) error {
+	for {
+		b, err := rows.next()
+		if err == io.EOF {
+			return nil
 		}
-		m := map[string]any{}
-		if err := json.Unmarshal(b, &m); err != nil {
-			return fmt.Errorf("failed to decode metadata fields in JSON: %w", err)
+		if err != nil {
+			return err
 		}
-		v.Metadata = map[string]any{}
-		for k, mv := range m {
-			if strings.HasPrefix(k, "metadata.") && mv != nil {
-				v.Metadata[k[9:]] = mv
-			}
+		var v PageView
+		if err := d.decode(b, &v, &v.Metadata, &v.ExtraFields); err != nil {
+			return err
 		}
 		out <- v
 	}
-	return nil
 }
 
 // ExportEvents returns all events for the given time range
@@ -206,35 +247,198 @@ func (c *Client) ExportEvents(ctx context.Context, opts ExportOptions, out chan<
 		return fmt.Errorf("failed to export data points: %w", err)
 	}
 	defer reader.Close()
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
+	rows, err := newRowReader(reader, opts.Format, fieldTypesEvents)
+	if err != nil {
+		return err
+	}
+	d := newRowDecoder(knownFieldsEvents, opts.Fields)
+	counted := &rowCounter{rows: rows}
+	if err := decodeEvents(counted, d, out); err != nil {
+		return err
+	}
+	if err := reader.finish(counted.n); err != nil {
+		return err
+	}
+	d.reportDrift(opts.OnFieldDrift)
+	if opts.OnTransfer != nil {
+		opts.OnTransfer(reader.stats())
+	}
+	return nil
+}
+
+// decodeEvents decodes events from rows.
+func decodeEvents(rows rowReader, d *rowDecoder, out chan<- Event) error {
+	for {
+		b, err := rows.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 		var v Event
-		b := scanner.Bytes()
-		if err := json.Unmarshal(b, &v); err != nil {
-			return fmt.Errorf("failed to decode JSON: %w", err)
+		if err := d.decode(b, &v, &v.Metadata, &v.ExtraFields); err != nil {
+			return err
 		}
-		m := map[string]any{}
-		if err := json.Unmarshal(b, &m); err != nil {
-			return fmt.Errorf("failed to decode metadata fields in JSON: %w", err)
+		out <- v
+	}
+}
+
+// maxLineSize is the maximum size of a single NDJSON line. Rows with long user agents, paths
+// and metadata can exceed bufio.Scanner's default limit of 64KB.
+const maxLineSize = 1024 * 1024
+
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
+// rowReader reads the rows of an export, each encoded as a JSON object. It returns io.EOF
+// after the last row.
+type rowReader interface {
+	next() ([]byte, error)
+}
+
+// newRowReader returns a reader for rows in the given format. fieldTypes are the Go types of
+// the known fields, which CSV values are converted to.
+func newRowReader(r io.Reader, format Format, fieldTypes map[string]reflect.Type) (rowReader, error) {
+	switch format {
+	case "", FormatNDJSON:
+		return &ndjsonReader{scanner: newScanner(r)}, nil
+	case FormatCSV:
+		return newCSVReader(r, fieldTypes), nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// ndjsonReader reads NDJSON rows, skipping blank lines.
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *ndjsonReader) next() ([]byte, error) {
+	for r.scanner.Scan() {
+		b := r.scanner.Bytes()
+		if len(bytes.TrimSpace(b)) > 0 {
+			return b, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read data points: %w", err)
+	}
+	return nil, io.EOF
+}
+
+var (
+	fieldTypesPageViews = jsonFieldTypes(PageView{})
+	fieldTypesEvents    = jsonFieldTypes(Event{})
+
+	knownFieldsPageViews = jsonFields(PageView{})
+	knownFieldsEvents    = jsonFields(Event{})
+)
+
+// jsonFieldTypes returns the types of the fields of the given struct, by JSON key.
+func jsonFieldTypes(v any) map[string]reflect.Type {
+	t := reflect.TypeOf(v)
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
 		}
-		v.Metadata = map[string]any{}
-		for k, mv := range m {
-			if strings.HasPrefix(k, "metadata.") && mv != nil {
-				v.Metadata[k[9:]] = mv
+	}
+	return fields
+}
+
+// jsonFields returns the JSON keys mapped to fields of the given struct.
+func jsonFields(v any) map[string]bool {
+	fields := make(map[string]bool)
+	for name := range jsonFieldTypes(v) {
+		fields[name] = true
+	}
+	return fields
+}
+
+// rowDecoder decodes NDJSON rows, splitting keys that are not mapped to struct fields into
+// metadata and extra fields, and keeps track of schema drift across rows.
+type rowDecoder struct {
+	known      map[string]bool
+	requested  []string
+	seen       map[string]bool
+	unexpected map[string]bool
+}
+
+func newRowDecoder(known map[string]bool, requested []string) *rowDecoder {
+	return &rowDecoder{
+		known:      known,
+		requested:  requested,
+		seen:       make(map[string]bool),
+		unexpected: make(map[string]bool),
+	}
+}
+
+func (d *rowDecoder) decode(b []byte, v any, metadata, extra *map[string]any) error {
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("failed to decode metadata fields in JSON: %w", err)
+	}
+	*metadata = map[string]any{}
+	*extra = map[string]any{}
+	for k, mv := range m {
+		d.seen[k] = true
+		switch {
+		case strings.HasPrefix(k, "metadata."):
+			if mv != nil {
+				(*metadata)[k[9:]] = mv
+			}
+		case !d.known[k]:
+			d.unexpected[k] = true
+			if mv != nil {
+				(*extra)[k] = mv
 			}
 		}
-		out <- v
 	}
 	return nil
 }
 
+// reportDrift calls fn with the unexpected and missing fields, if there are any.
+// Missing fields can only be detected if at least one row was decoded.
+func (d *rowDecoder) reportDrift(fn func(unexpected, missing []string)) {
+	if fn == nil || len(d.seen) == 0 {
+		return
+	}
+	unexpected := make([]string, 0, len(d.unexpected))
+	for k := range d.unexpected {
+		unexpected = append(unexpected, k)
+	}
+	sort.Strings(unexpected)
+	var missing []string
+	for _, k := range d.requested {
+		if !d.seen[k] && !strings.HasPrefix(k, "metadata.") {
+			missing = append(missing, k)
+		}
+	}
+	if len(unexpected) > 0 || len(missing) > 0 {
+		fn(unexpected, missing)
+	}
+}
+
 func getQueryParams(opts ExportOptions) url.Values {
 	values := url.Values{}
 	values.Set("start", opts.Start.Format(dateLayout))
 	values.Set("end", opts.End.Format(dateLayout))
 	values.Set("fields", strings.Join(opts.Fields, ","))
 	values.Set("version", "5")
-	values.Set("format", "ndjson")
+	format := opts.Format
+	if format == "" {
+		format = FormatNDJSON
+	}
+	values.Set("format", string(format))
 	values.Set("hostname", opts.Hostname)
 	return values
 }
@@ -0,0 +1,152 @@
+package simpleanalytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sync/errgroup"
+)
+
+// addTestdataSeeds adds every field of the testdata exports to the seed corpus, each as an object of
+// its own. Whole rows are not added: the fuzzer minimizes every new interesting input in time
+// quadratic in its size, which for rows of several hundred bytes takes up all of
+// -fuzzminimizetime and stalls fuzzing.
+func addTestdataSeeds(f *testing.F) {
+	f.Helper()
+	for _, name := range []string{"testdata/pageviews.ndjson", "testdata/events.ndjson"} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatalf("unexpected error reading testdata file: %v", err)
+		}
+		for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+			var row map[string]json.RawMessage
+			if err := json.Unmarshal(line, &row); err != nil {
+				f.Fatalf("unexpected error decoding testdata row: %v", err)
+			}
+			for k, v := range row {
+				seed, err := json.Marshal(map[string]json.RawMessage{k: v})
+				if err != nil {
+					f.Fatal(err)
+				}
+				f.Add(seed)
+			}
+		}
+	}
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"metadata.":1,"metadata.x":null}`))
+	f.Add([]byte("\n\n{}\n"))
+	f.Add([]byte(`{"hostname":"test.com"}` + "\n" + `{"metadata.a_int":1}`))
+}
+
+func FuzzDecodePageViews(f *testing.F) {
+	addTestdataSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d := newRowDecoder(knownFieldsPageViews, ExportFieldsPageViews)
+		rows, err := decodeAll(func(out chan<- PageView) error {
+			return decodePageViews(&ndjsonReader{scanner: newScanner(bytes.NewReader(b))}, d, out)
+		})
+		if err != nil {
+			return
+		}
+		for _, v := range rows {
+			checkDecodedKeys(t, knownFieldsPageViews, v.Metadata, v.ExtraFields)
+		}
+		d.reportDrift(func(unexpected, missing []string) {})
+	})
+}
+
+func FuzzDecodeEvents(f *testing.F) {
+	addTestdataSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		d := newRowDecoder(knownFieldsEvents, ExportFieldsEvents)
+		rows, err := decodeAll(func(out chan<- Event) error {
+			return decodeEvents(&ndjsonReader{scanner: newScanner(bytes.NewReader(b))}, d, out)
+		})
+		if err != nil {
+			return
+		}
+		for _, v := range rows {
+			checkDecodedKeys(t, knownFieldsEvents, v.Metadata, v.ExtraFields)
+		}
+	})
+}
+
+// decodeAll runs decode and returns the rows it sends to its output channel, which is drained
+// concurrently so that decode never blocks, however many rows the input holds.
+func decodeAll[T any](decode func(out chan<- T) error) ([]T, error) {
+	ch := make(chan T)
+	g := errgroup.Group{}
+	g.Go(func() error {
+		defer close(ch)
+		return decode(ch)
+	})
+	var rows []T
+	for v := range ch {
+		rows = append(rows, v)
+	}
+	return rows, g.Wait()
+}
+
+func checkDecodedKeys(t *testing.T, known map[string]bool, metadata, extra map[string]any) {
+	t.Helper()
+	if metadata == nil || extra == nil {
+		t.Fatalf("expected non-nil metadata and extra fields, got %v and %v", metadata, extra)
+	}
+	for k, v := range metadata {
+		if v == nil {
+			t.Errorf("unexpected nil metadata value for %q", k)
+		}
+	}
+	for k := range extra {
+		if strings.HasPrefix(k, "metadata.") || known[k] {
+			t.Errorf("unexpected extra field %q", k)
+		}
+	}
+}
+
+// FuzzMetadataRoundTrip checks that metadata written as metadata.<key> fields is extracted unchanged.
+func FuzzMetadataRoundTrip(f *testing.F) {
+	f.Add("fieldname_text", "test", 123.0, true)
+	f.Add("fieldname_date", "2023-01-20T14:57:59.698Z", -1.5, false)
+	f.Add("", "", 0.0, false)
+	f.Add("a.b", " \x00", 1e300, true)
+	f.Fuzz(func(t *testing.T, key, s string, n float64, b bool) {
+		want := map[string]any{
+			key + "_text": s,
+			key + "_int":  n,
+			key + "_bool": b,
+		}
+		row := map[string]any{"hostname": "test.com"}
+		for k, v := range want {
+			row["metadata."+k] = v
+		}
+		line, err := json.Marshal(row)
+		if err != nil {
+			// e.g. NaN or infinite numbers, which are not valid JSON
+			return
+		}
+		var v PageView
+		d := newRowDecoder(knownFieldsPageViews, nil)
+		if err := d.decode(line, &v, &v.Metadata, &v.ExtraFields); err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", line, err)
+		}
+		// invalid UTF-8 is replaced while encoding, so compare against what was actually encoded
+		var encoded map[string]any
+		if err := json.Unmarshal(line, &encoded); err != nil {
+			t.Fatal(err)
+		}
+		wantDecoded := map[string]any{}
+		for k, v := range encoded {
+			if strings.HasPrefix(k, "metadata.") {
+				wantDecoded[strings.TrimPrefix(k, "metadata.")] = v
+			}
+		}
+		if diff := cmp.Diff(wantDecoded, v.Metadata); diff != "" {
+			t.Errorf("metadata did not round-trip. diff: %s", diff)
+		}
+	})
+}
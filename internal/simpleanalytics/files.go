@@ -0,0 +1,202 @@
+package simpleanalytics
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exporter exports page views and events. It is implemented by Client, which exports them from
+// the API, and by FileClient, which reads them from export files.
+type Exporter interface {
+	ExportPageViews(ctx context.Context, opts ExportOptions, out chan<- PageView) error
+	ExportEvents(ctx context.Context, opts ExportOptions, out chan<- Event) error
+}
+
+var (
+	_ Exporter = (*Client)(nil)
+	_ Exporter = (*FileClient)(nil)
+)
+
+// FileClient reads page views and events from export files, such as the ones downloaded from the
+// Simple Analytics dashboard, instead of the API.
+//
+// Files are NDJSON (.ndjson, .jsonl or .json) or CSV (.csv), optionally gzipped (.gz), and are
+// decoded like API responses. Page views and events can be mixed in the same files, as events are
+// told apart by their datapoint field, which event exports must include. Rows of other hostnames and outside of the requested date
+// range are skipped, so the same files can be shared by several websites.
+type FileClient struct {
+	pattern string
+}
+
+// NewFileClient returns a client reading the files matching pattern, which is either a directory,
+// whose files with a supported extension are read, or a glob as supported by filepath.Match.
+func NewFileClient(pattern string) *FileClient {
+	return &FileClient{pattern: pattern}
+}
+
+// Files returns the files read by the client, in lexical order.
+func (c *FileClient) Files() ([]string, error) {
+	if fi, err := os.Stat(c.pattern); err == nil && fi.IsDir() {
+		entries, err := os.ReadDir(c.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list export files: %w", err)
+		}
+		var files []string
+		for _, e := range entries {
+			if _, _, err := fileFormat(e.Name()); err == nil && !e.IsDir() {
+				files = append(files, filepath.Join(c.pattern, e.Name()))
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no export files found in directory %s", c.pattern)
+		}
+		return files, nil
+	}
+	files, err := filepath.Glob(c.pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid files pattern %q: %w", c.pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no export files match %s", c.pattern)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ExportPageViews returns all page views for the given time range from the export files.
+func (c *FileClient) ExportPageViews(ctx context.Context, opts ExportOptions, out chan<- PageView) error {
+	if len(opts.Fields) == 0 {
+		opts.Fields = ExportFieldsPageViews
+	}
+	d := newRowDecoder(knownFieldsPageViews, opts.Fields)
+	err := c.export(ctx, opts, fieldTypesPageViews, false, func(rows rowReader) error {
+		return decodePageViews(rows, d, out)
+	})
+	if err != nil {
+		return err
+	}
+	d.reportDrift(opts.OnFieldDrift)
+	return nil
+}
+
+// ExportEvents returns all events for the given time range from the export files.
+func (c *FileClient) ExportEvents(ctx context.Context, opts ExportOptions, out chan<- Event) error {
+	if len(opts.Fields) == 0 {
+		opts.Fields = ExportFieldsEvents
+	}
+	d := newRowDecoder(knownFieldsEvents, opts.Fields)
+	err := c.export(ctx, opts, fieldTypesEvents, true, func(rows rowReader) error {
+		return decodeEvents(rows, d, out)
+	})
+	if err != nil {
+		return err
+	}
+	d.reportDrift(opts.OnFieldDrift)
+	return nil
+}
+
+func (c *FileClient) export(ctx context.Context, opts ExportOptions, fieldTypes map[string]reflect.Type, events bool, decode func(rowReader) error) error {
+	files, err := c.Files()
+	if err != nil {
+		return err
+	}
+	// like the API, the dates of both start and end are inclusive
+	start, _ := time.Parse(dateLayout, opts.Start.Format(dateLayout))
+	end, _ := time.Parse(dateLayout, opts.End.Format(dateLayout))
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := readFile(name, fieldTypes, func(rows rowReader) error {
+			return decode(&fileRowFilter{
+				rows:     rows,
+				hostname: opts.Hostname,
+				start:    start,
+				end:      end.AddDate(0, 0, 1),
+				events:   events,
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read export file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func readFile(name string, fieldTypes map[string]reflect.Type, fn func(rowReader) error) error {
+	format, gzipped, err := fileFormat(name)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if gzipped {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	rows, err := newRowReader(r, format, fieldTypes)
+	if err != nil {
+		return err
+	}
+	return fn(rows)
+}
+
+// fileFormat returns the format of an export file and whether it is gzipped, based on its extension.
+func fileFormat(name string) (Format, bool, error) {
+	base := strings.ToLower(name)
+	gzipped := strings.HasSuffix(base, ".gz")
+	switch filepath.Ext(strings.TrimSuffix(base, ".gz")) {
+	case ".ndjson", ".jsonl", ".json":
+		return FormatNDJSON, gzipped, nil
+	case ".csv":
+		return FormatCSV, gzipped, nil
+	default:
+		return "", false, fmt.Errorf("unsupported export file extension in %s, expected .ndjson, .jsonl, .json or .csv, optionally followed by .gz", name)
+	}
+}
+
+// fileRowFilter skips the rows of other hostnames, outside of [start, end) or of the other type.
+type fileRowFilter struct {
+	rows       rowReader
+	hostname   string
+	start, end time.Time
+	events     bool
+}
+
+func (f *fileRowFilter) next() ([]byte, error) {
+	for {
+		b, err := f.rows.next()
+		if err != nil {
+			return nil, err
+		}
+		var row struct {
+			AddedISO  time.Time `json:"added_iso"`
+			Hostname  string    `json:"hostname"`
+			Datapoint *string   `json:"datapoint"`
+		}
+		if err := json.Unmarshal(b, &row); err != nil {
+			return nil, fmt.Errorf("failed to decode JSON: %w", err)
+		}
+		if !strings.EqualFold(row.Hostname, f.hostname) || row.AddedISO.Before(f.start) || !row.AddedISO.Before(f.end) || (row.Datapoint != nil) != f.events {
+			continue
+		}
+		return b, nil
+	}
+}
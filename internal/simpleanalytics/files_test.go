@@ -0,0 +1,143 @@
+package simpleanalytics
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sync/errgroup"
+)
+
+// newExportDir returns a directory with the page views testdata as gzipped NDJSON, events as CSV,
+// and a file that is not an export.
+func newExportDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	b, err := os.ReadFile("testdata/pageviews.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "pageviews.ndjson.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write(b)
+	zw.Close()
+	f.Close()
+	events := "added_iso,hostname,datapoint,metadata.plan_text\n" +
+		"2023-01-23T11:40:16.137Z,saasforcovid.com,signup,pro\n" +
+		"2023-01-24T12:43:35.689Z,saasforcovid.com,login,\n"
+	if err := os.WriteFile(filepath.Join(dir, "events.csv"), []byte(events), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.txt"), []byte("downloaded from the dashboard"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func collect[T any](t *testing.T, export func(context.Context, ExportOptions, chan<- T) error, opts ExportOptions) ([]string, error) {
+	t.Helper()
+	ch := make(chan T)
+	g := errgroup.Group{}
+	g.Go(func() error {
+		defer close(ch)
+		return export(context.Background(), opts, ch)
+	})
+	var dates []string
+	for v := range ch {
+		switch v := any(v).(type) {
+		case PageView:
+			dates = append(dates, v.AddedISO.Format(dateLayout))
+		case Event:
+			dates = append(dates, v.Datapoint+"@"+v.AddedISO.Format(dateLayout))
+		}
+	}
+	return dates, g.Wait()
+}
+
+func TestFileClient(t *testing.T) {
+	dir := newExportDir(t)
+	all := ExportOptions{
+		Hostname: testHostname,
+		Start:    time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		End:      time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	oneDay := all
+	oneDay.Start = time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC)
+	oneDay.End = oneDay.Start
+	otherHost := all
+	otherHost.Hostname = "example.com"
+
+	tests := []struct {
+		name          string
+		pattern       string
+		opts          ExportOptions
+		wantPageViews []string
+		wantEvents    []string
+	}{
+		{
+			name:          "directory",
+			pattern:       dir,
+			opts:          all,
+			wantPageViews: []string{"2022-12-23", "2023-01-05", "2023-01-20"},
+			wantEvents:    []string{"signup@2023-01-23", "login@2023-01-24"},
+		},
+		{
+			name:          "date range",
+			pattern:       dir,
+			opts:          oneDay,
+			wantPageViews: []string{"2023-01-05"},
+		},
+		{
+			name:    "other hostname",
+			pattern: dir,
+			opts:    otherHost,
+		},
+		{
+			name:       "glob",
+			pattern:    filepath.Join(dir, "*.csv"),
+			opts:       all,
+			wantEvents: []string{"signup@2023-01-23", "login@2023-01-24"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewFileClient(tc.pattern)
+			got, err := collect(t, c.ExportPageViews, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantPageViews, got); diff != "" {
+				t.Errorf("unexpected page views. diff: %s", diff)
+			}
+			if got, err = collect(t, c.ExportEvents, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantEvents, got); diff != "" {
+				t.Errorf("unexpected events. diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestFileClientErrors(t *testing.T) {
+	dir := newExportDir(t)
+	opts := ExportOptions{Hostname: testHostname, Start: time.Now(), End: time.Now()}
+	for pattern, want := range map[string]string{
+		filepath.Join(dir, "*.ndjson"): "no export files match",
+		t.TempDir():                    "no export files found in directory",
+		filepath.Join(dir, "*.txt"):    "unsupported export file extension",
+	} {
+		_, err := collect(t, NewFileClient(pattern).ExportPageViews, opts)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q for %s, got: %v", want, pattern, err)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+// Package satest provides an in-memory fake of the Simple Analytics export API for tests.
+//
+// Unlike a fixed response handler, the fake stores data points and honors the hostname,
+// type, start, end, fields and format query parameters, validates the User-Id and Api-Key headers,
+// can inject errors, latency and rate limiting, and compresses responses like the real API.
+package satest
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+)
+
+const (
+	// TypePageViews is the export type of page views.
+	TypePageViews = "pageviews"
+	// TypeEvents is the export type of events.
+	TypeEvents = "events"
+
+	exportPath = "/api/export/datapoints"
+	dateLayout = "2006-01-02"
+)
+
+// Server is a fake Simple Analytics server. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	userID string
+	apiKey string
+
+	mu          sync.Mutex
+	datapoints  map[string][]map[string]any
+	errs        []injectedError
+	rateLimited int
+	retryAfter  time.Duration
+	latency     time.Duration
+	encodings   []string
+	requests    []Request
+}
+
+// Request is a request received by the fake server.
+type Request struct {
+	Query  map[string]string
+	Header http.Header
+}
+
+type injectedError struct {
+	code int
+	body string
+}
+
+// NewServer starts a fake server that accepts the given credentials.
+// The server must be closed by the caller.
+func NewServer(userID, apiKey string) *Server {
+	s := &Server{
+		userID:     userID,
+		apiKey:     apiKey,
+		datapoints: make(map[string][]map[string]any),
+		encodings:  []string{"gzip", "br"},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// AddPageViews stores page views. Metadata keys are exported as metadata.<key> fields.
+func (s *Server) AddPageViews(pvs ...simpleanalytics.PageView) {
+	for _, pv := range pvs {
+		s.AddRaw(TypePageViews, toRow(pv, pv.Metadata))
+	}
+}
+
+// AddEvents stores events. Metadata keys are exported as metadata.<key> fields.
+func (s *Server) AddEvents(evs ...simpleanalytics.Event) {
+	for _, ev := range evs {
+		s.AddRaw(TypeEvents, toRow(ev, ev.Metadata))
+	}
+}
+
+// AddRaw stores a data point of the given type as-is. It must have an added_iso field to be
+// matched by date range, and a hostname field to be matched by hostname.
+func (s *Server) AddRaw(typ string, row map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.datapoints[typ] = append(s.datapoints[typ], row)
+}
+
+// InjectError makes the next request that is not rate limited fail with the given status code.
+// Multiple errors are returned in the order they were injected.
+func (s *Server) InjectError(code int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, injectedError{code: code, body: body})
+}
+
+// RateLimit makes the next n requests fail with 429 Too Many Requests and the given Retry-After.
+func (s *Server) RateLimit(n int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimited = n
+	s.retryAfter = retryAfter
+}
+
+// SetEncodings sets the content encodings the server supports, in order of preference.
+// By default, it responds with gzip or br, whichever the client accepts first.
+// Without encodings, responses are never compressed.
+func (s *Server) SetEncodings(encodings ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encodings = encodings
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Requests returns all requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := make([]Request, len(s.requests))
+	copy(l, s.requests)
+	return l
+}
+
+func toRow(v any, metadata map[string]any) map[string]any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	row := make(map[string]any)
+	if err := json.Unmarshal(b, &row); err != nil {
+		panic(err)
+	}
+	for k, mv := range metadata {
+		row["metadata."+k] = mv
+	}
+	return row
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	q := make(map[string]string)
+	for k := range r.URL.Query() {
+		q[k] = r.URL.Query().Get(k)
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Query: q, Header: r.Header.Clone()})
+	latency := s.latency
+	encodings := s.encodings
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if r.URL.Path != exportPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("User-Id") != s.userID || r.Header.Get("Api-Key") != s.apiKey {
+		http.Error(w, `{"ok":false,"error":"invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	if code, body, ok := s.nextError(); ok {
+		http.Error(w, body, code)
+		return
+	}
+
+	rows, err := s.query(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"ok":false,"error":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+	csvFormat := q["format"] == "csv"
+	if csvFormat {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	var out io.Writer = w
+	switch negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings) {
+	case "gzip":
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		defer zw.Close()
+		out = zw
+	case "br":
+		w.Header().Set("Content-Encoding", "br")
+		bw := brotli.NewWriter(w)
+		defer bw.Close()
+		out = bw
+	}
+	w.WriteHeader(http.StatusOK)
+	if csvFormat {
+		writeCSV(out, rows, q["fields"])
+		return
+	}
+	enc := json.NewEncoder(out)
+	for _, row := range rows {
+		_ = enc.Encode(row)
+	}
+}
+
+// writeCSV writes rows with a header of the requested fields, or of all fields in the rows if
+// none were requested. Null values are written as empty strings.
+func writeCSV(out io.Writer, rows []map[string]any, fields string) {
+	var header []string
+	if fields != "" {
+		header = strings.Split(fields, ",")
+	} else {
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			for k := range row {
+				if !seen[k] {
+					seen[k] = true
+					header = append(header, k)
+				}
+			}
+		}
+		sort.Strings(header)
+	}
+	cw := csv.NewWriter(out)
+	_ = cw.Write(header)
+	record := make([]string, len(header))
+	for _, row := range rows {
+		for i, k := range header {
+			switch v := row[k].(type) {
+			case nil:
+				record[i] = ""
+			case string:
+				record[i] = v
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		_ = cw.Write(record)
+	}
+	cw.Flush()
+}
+
+// negotiateEncoding returns the first of the accepted encodings that the server supports.
+// Quality values are ignored.
+func negotiateEncoding(accept string, supported []string) string {
+	for _, a := range strings.Split(accept, ",") {
+		a, _, _ = strings.Cut(strings.TrimSpace(a), ";")
+		for _, s := range supported {
+			if strings.EqualFold(a, s) {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Server) nextError() (int, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rateLimited > 0 {
+		s.rateLimited--
+		return http.StatusTooManyRequests, fmt.Sprintf(`{"ok":false,"error":"rate limited","retry_after":%d}`, int(s.retryAfter.Seconds())), true
+	}
+	if len(s.errs) > 0 {
+		e := s.errs[0]
+		s.errs = s.errs[1:]
+		return e.code, e.body, true
+	}
+	return 0, "", false
+}
+
+// query returns the rows matching the query parameters, restricted to the requested fields
+// and ordered by added_iso.
+func (s *Server) query(q map[string]string) ([]map[string]any, error) {
+	typ := q["type"]
+	if typ != TypePageViews && typ != TypeEvents {
+		return nil, fmt.Errorf("invalid type %q", typ)
+	}
+	if q["hostname"] == "" {
+		return nil, fmt.Errorf("hostname is required")
+	}
+	if f := q["format"]; f != "" && f != "ndjson" && f != "csv" {
+		return nil, fmt.Errorf("unsupported format %q", f)
+	}
+	start, err := time.Parse(dateLayout, q["start"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err := time.Parse(dateLayout, q["end"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid end: %w", err)
+	}
+	var fields []string
+	if q["fields"] != "" {
+		fields = strings.Split(q["fields"], ",")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rows []map[string]any
+	for _, row := range s.datapoints[typ] {
+		if row["hostname"] != q["hostname"] {
+			continue
+		}
+		added := addedTime(row)
+		// both start and end dates are inclusive
+		if added.Before(start) || !added.Before(end.AddDate(0, 0, 1)) {
+			continue
+		}
+		rows = append(rows, selectFields(row, fields))
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return addedTime(rows[i]).Before(addedTime(rows[j]))
+	})
+	return rows, nil
+}
+
+func addedTime(row map[string]any) time.Time {
+	s, _ := row["added_iso"].(string)
+	t, _ := time.Parse(time.RFC3339, s)
+	return t.UTC()
+}
+
+// selectFields returns the requested fields of the row, with null for fields the row does not have.
+// If no fields are requested, the full row is returned.
+func selectFields(row map[string]any, fields []string) map[string]any {
+	if len(fields) == 0 {
+		return row
+	}
+	out := make(map[string]any, len(fields))
+	for _, f := range fields {
+		out[f] = row[f]
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package satest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics/satest"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	testUserID = "sa_user_id_test"
+	testAPIKey = "sa_api_key_test"
+)
+
+func day(d int) time.Time {
+	return time.Date(2023, 1, d, 12, 0, 0, 0, time.UTC)
+}
+
+func newTestServer(t *testing.T) *satest.Server {
+	t.Helper()
+	s := satest.NewServer(testUserID, testAPIKey)
+	t.Cleanup(s.Close)
+	s.AddPageViews(
+		simpleanalytics.PageView{Hostname: "a.com", UUID: "3", AddedISO: day(3), Path: "/3"},
+		simpleanalytics.PageView{Hostname: "a.com", UUID: "1", AddedISO: day(1), Path: "/1", Metadata: map[string]any{"plan_text": "pro"}},
+		simpleanalytics.PageView{Hostname: "a.com", UUID: "2", AddedISO: day(2), Path: "/2"},
+		simpleanalytics.PageView{Hostname: "b.com", UUID: "4", AddedISO: day(2), Path: "/4"},
+	)
+	s.AddEvents(simpleanalytics.Event{Hostname: "a.com", Datapoint: "signup", AddedISO: day(2)})
+	return s
+}
+
+func exportPageViews(c *simpleanalytics.Client, opts simpleanalytics.ExportOptions) ([]simpleanalytics.PageView, error) {
+	ch := make(chan simpleanalytics.PageView)
+	g := errgroup.Group{}
+	g.Go(func() error {
+		defer close(ch)
+		return c.ExportPageViews(context.Background(), opts, ch)
+	})
+	var got []simpleanalytics.PageView
+	for v := range ch {
+		got = append(got, v)
+	}
+	return got, g.Wait()
+}
+
+func TestServerFilters(t *testing.T) {
+	s := newTestServer(t)
+	c := simpleanalytics.NewClient(testUserID, testAPIKey, simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+
+	got, err := exportPageViews(c, simpleanalytics.ExportOptions{
+		Hostname: "a.com",
+		Start:    day(1),
+		End:      day(2),
+		Fields:   []string{"uuid", "path", "metadata.plan_text"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []simpleanalytics.PageView{
+		{UUID: "1", Path: "/1", Metadata: map[string]any{"plan_text": "pro"}, ExtraFields: map[string]any{}},
+		{UUID: "2", Path: "/2", Metadata: map[string]any{}, ExtraFields: map[string]any{}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected page views. diff: %s", diff)
+	}
+
+	reqs := s.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(reqs))
+	}
+	if reqs[0].Query["type"] != satest.TypePageViews {
+		t.Errorf("unexpected type in request. got: %s, want: %s", reqs[0].Query["type"], satest.TypePageViews)
+	}
+}
+
+func TestServerCSV(t *testing.T) {
+	s := newTestServer(t)
+	c := simpleanalytics.NewClient(testUserID, testAPIKey, simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+	opts := simpleanalytics.ExportOptions{
+		Hostname: "a.com",
+		Start:    day(1),
+		End:      day(3),
+		Fields:   append(simpleanalytics.ExportFieldsPageViews, "metadata.plan_text"),
+	}
+	want, err := exportPageViews(c, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts.Format = simpleanalytics.FormatCSV
+	got, err := exportPageViews(c, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CSV page views differ from NDJSON page views. diff: %s", diff)
+	}
+	if f := s.Requests()[1].Query["format"]; f != "csv" {
+		t.Errorf("unexpected format in request. got: %s, want: csv", f)
+	}
+}
+
+func TestServerCredentials(t *testing.T) {
+	s := newTestServer(t)
+	c := simpleanalytics.NewClient(testUserID, "wrong", simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+
+	_, err := exportPageViews(c, simpleanalytics.ExportOptions{Hostname: "a.com", Start: day(1), End: day(3)})
+	var httpErr simpleanalytics.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 error, got: %v", err)
+	}
+}
+
+func TestServerInjectedErrors(t *testing.T) {
+	s := newTestServer(t)
+	c := simpleanalytics.NewClient(testUserID, testAPIKey, simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+	opts := simpleanalytics.ExportOptions{Hostname: "a.com", Start: day(1), End: day(3)}
+
+	s.RateLimit(1, time.Second)
+	s.InjectError(http.StatusInternalServerError, "boom")
+	for _, want := range []int{http.StatusTooManyRequests, http.StatusInternalServerError} {
+		_, err := exportPageViews(c, opts)
+		var httpErr simpleanalytics.HTTPError
+		if !errors.As(err, &httpErr) || httpErr.Code != want {
+			t.Fatalf("expected %d error, got: %v", want, err)
+		}
+	}
+	got, err := exportPageViews(c, opts)
+	if err != nil {
+		t.Fatalf("unexpected error after injected errors: %v", err)
+	}
+	if len(got) != 3 {
+		t.Errorf("expected 3 page views, got %d", len(got))
+	}
+}
+
+func TestServerLatency(t *testing.T) {
+	s := newTestServer(t)
+	s.SetLatency(time.Second)
+	c := simpleanalytics.NewClient(testUserID, testAPIKey, simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.ExportPageViews(ctx, simpleanalytics.ExportOptions{Hostname: "a.com", Start: day(1), End: day(3)}, make(chan simpleanalytics.PageView))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+}
+
+func TestServerEncodings(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		encodings []string
+		want      string
+	}{
+		{name: "default", want: "gzip"},
+		{name: "brotli", encodings: []string{"br"}, want: "br"},
+		{name: "identity", encodings: []string{}, want: ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			if tc.encodings != nil {
+				s.SetEncodings(tc.encodings...)
+			}
+			c := simpleanalytics.NewClient(testUserID, testAPIKey, simpleanalytics.WithBaseURL(s.URL), simpleanalytics.WithHTTPClient(s.Client()))
+			var stats simpleanalytics.TransferStats
+			got, err := exportPageViews(c, simpleanalytics.ExportOptions{
+				Hostname:   "a.com",
+				Start:      day(1),
+				End:        day(3),
+				OnTransfer: func(ts simpleanalytics.TransferStats) { stats = ts },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 3 {
+				t.Errorf("expected 3 page views, got %d", len(got))
+			}
+			if stats.Encoding != tc.want {
+				t.Errorf("unexpected encoding: got %q, want %q", stats.Encoding, tc.want)
+			}
+			if stats.WireBytes == 0 || stats.DecodedBytes == 0 {
+				t.Errorf("expected non-zero transfer stats, got %+v", stats)
+			}
+			if tc.want == "" && stats.WireBytes != stats.DecodedBytes {
+				t.Errorf("expected wire and decoded bytes to match without encoding, got %+v", stats)
+			}
+		})
+	}
+}
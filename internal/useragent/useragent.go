@@ -0,0 +1,120 @@
+// Package useragent implements an offline user agent parser for the details that the
+// Simple Analytics export does not provide, such as the rendering engine and device model.
+//
+// Parsing is driven by the rules in rules.json, which are evaluated in order; the first
+// matching rule of every section wins.
+package useragent
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed rules.json
+var defaultRules []byte
+
+// Info is the result of parsing a user agent. Fields are empty if they could not be determined.
+type Info struct {
+	Engine      string
+	DeviceBrand string
+	DeviceModel string
+	IsWebview   bool
+}
+
+type rule struct {
+	Name   string `json:"name"`
+	Brand  string `json:"brand"`
+	Model  string `json:"model"`
+	Match  string `json:"match"`
+	Unless string `json:"unless"`
+
+	match  *regexp.Regexp
+	unless *regexp.Regexp
+}
+
+type rules struct {
+	Engines  []*rule `json:"engines"`
+	Devices  []*rule `json:"devices"`
+	Webviews []*rule `json:"webviews"`
+}
+
+// Parser parses user agents according to a set of rules.
+type Parser struct {
+	rules rules
+}
+
+var defaultParser = MustNewParser(defaultRules)
+
+// NewParser returns a parser for the given JSON rules, in the format of the embedded rules.json.
+func NewParser(b []byte) (*Parser, error) {
+	var r rules
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode rules: %w", err)
+	}
+	for _, section := range [][]*rule{r.Engines, r.Devices, r.Webviews} {
+		for _, ru := range section {
+			var err error
+			if ru.match, err = regexp.Compile(ru.Match); err != nil {
+				return nil, fmt.Errorf("invalid match %q: %w", ru.Match, err)
+			}
+			if ru.Unless == "" {
+				continue
+			}
+			if ru.unless, err = regexp.Compile(ru.Unless); err != nil {
+				return nil, fmt.Errorf("invalid unless %q: %w", ru.Unless, err)
+			}
+		}
+	}
+	return &Parser{rules: r}, nil
+}
+
+// MustNewParser is like NewParser but panics if the rules are invalid.
+func MustNewParser(b []byte) *Parser {
+	p, err := NewParser(b)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Parse parses the user agent using the embedded rules.
+func Parse(ua string) Info {
+	return defaultParser.Parse(ua)
+}
+
+// Parse parses the user agent.
+func (p *Parser) Parse(ua string) Info {
+	var info Info
+	if ua == "" {
+		return info
+	}
+	if r, _ := first(p.rules.Engines, ua); r != nil {
+		info.Engine = r.Name
+	}
+	if r, m := first(p.rules.Devices, ua); r != nil {
+		info.DeviceBrand = r.Brand
+		info.DeviceModel = strings.TrimSpace(string(r.match.ExpandString(nil, r.Model, ua, m)))
+	}
+	if r, _ := first(p.rules.Webviews, ua); r != nil {
+		info.IsWebview = true
+	}
+	return info
+}
+
+// first returns the first rule matching ua, and the submatch indexes of the match.
+func first(rules []*rule, ua string) (*rule, []int) {
+	for _, r := range rules {
+		m := r.match.FindStringSubmatchIndex(ua)
+		if m == nil {
+			continue
+		}
+		if r.unless != nil && r.unless.MatchString(ua) {
+			continue
+		}
+		return r, m
+	}
+	return nil, nil
+}
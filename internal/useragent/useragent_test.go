@@ -0,0 +1,127 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "empty",
+			ua:   "",
+			want: Info{},
+		},
+		{
+			name: "desktop firefox",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/109.0",
+			want: Info{Engine: "Gecko", DeviceBrand: "Apple", DeviceModel: "Mac"},
+		},
+		{
+			name: "desktop chrome on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36",
+			want: Info{Engine: "Blink"},
+		},
+		{
+			name: "legacy edge",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0.3538.102 Safari/537.36 Edge/18.19582",
+			want: Info{Engine: "EdgeHTML"},
+		},
+		{
+			name: "internet explorer",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want: Info{Engine: "Trident"},
+		},
+		{
+			name: "iphone safari",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.2 Mobile/15E148 Safari/604.1",
+			want: Info{Engine: "WebKit", DeviceBrand: "Apple", DeviceModel: "iPhone"},
+		},
+		{
+			name: "chrome on ios is webkit",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/108.0.5359.112 Mobile/15E148 Safari/604.1",
+			want: Info{Engine: "WebKit", DeviceBrand: "Apple", DeviceModel: "iPad"},
+		},
+		{
+			name: "ios in-app browser",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+			want: Info{Engine: "WebKit", DeviceBrand: "Apple", DeviceModel: "iPhone", IsWebview: true},
+		},
+		{
+			name: "instagram on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 Instagram 263.2.0.19.104 (iPhone14,2; iOS 16_1; en_US; en-US; scale=3.00; 1170x2532; 414172424)",
+			want: Info{Engine: "WebKit", DeviceBrand: "Apple", DeviceModel: "iPhone", IsWebview: true},
+		},
+		{
+			name: "samsung chrome",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "Samsung", DeviceModel: "SM-G991B"},
+		},
+		{
+			name: "samsung browser",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SAMSUNG SM-A525F) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/19.0 Chrome/102.0.5005.125 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "Samsung", DeviceModel: "SM-A525F"},
+		},
+		{
+			name: "android webview",
+			ua:   "Mozilla/5.0 (Linux; Android 13; Pixel 7 Build/TQ1A.221205.011; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/108.0.5359.128 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "Google", DeviceModel: "Pixel 7", IsWebview: true},
+		},
+		{
+			name: "facebook on android",
+			ua:   "Mozilla/5.0 (Linux; Android 12; Redmi Note 10 Pro Build/SKQ1.210908.001; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/108.0.5359.128 Mobile Safari/537.36 [FB_IAB/FB4A;FBAV/397.0.0.23.404;]",
+			want: Info{Engine: "Blink", DeviceBrand: "Xiaomi", DeviceModel: "Redmi Note 10 Pro", IsWebview: true},
+		},
+		{
+			name: "huawei",
+			ua:   "Mozilla/5.0 (Linux; Android 10; ELS-NX9) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "Huawei", DeviceModel: "ELS-NX9"},
+		},
+		{
+			name: "oneplus",
+			ua:   "Mozilla/5.0 (Linux; Android 11; KB2003) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "OnePlus", DeviceModel: "KB2003"},
+		},
+		{
+			name: "motorola firefox",
+			ua:   "Mozilla/5.0 (Android 12; Mobile; moto g(60); rv:108.0) Gecko/108.0 Firefox/108.0",
+			want: Info{Engine: "Gecko", DeviceBrand: "Motorola", DeviceModel: "moto g(60)"},
+		},
+		{
+			name: "motorola chrome",
+			ua:   "Mozilla/5.0 (Linux; Android 11; moto g(60)) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Mobile Safari/537.36",
+			want: Info{Engine: "Blink", DeviceBrand: "Motorola", DeviceModel: "moto g(60)"},
+		},
+		{
+			name: "opera presto",
+			ua:   "Opera/9.80 (Windows NT 6.1; WOW64) Presto/2.12.388 Version/12.18",
+			want: Info{Engine: "Presto"},
+		},
+		{
+			name: "bot",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, Parse(tc.ua)); diff != "" {
+				t.Errorf("unexpected result for %q. diff: %s", tc.ua, diff)
+			}
+		})
+	}
+}
+
+func TestNewParserInvalidRules(t *testing.T) {
+	if _, err := NewParser([]byte(`{"engines": [{"name": "x", "match": "("}]}`)); err == nil {
+		t.Fatal("expected error for invalid regular expression, got nil")
+	}
+	if _, err := NewParser([]byte(`not json`)); err == nil {
+		t.Fatal("expected error for invalid JSON, got nil")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	// embed the timezone database so the timezone option works in minimal containers
+	_ "time/tzdata"
+
 	"github.com/cloudquery/cq-source-simple-analytics/plugin"
 	"github.com/cloudquery/plugin-sdk/serve"
 )
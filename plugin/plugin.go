@@ -1,6 +1,8 @@
 package plugin
 
 import (
+	"context"
+
 	"github.com/cloudquery/cq-source-simple-analytics/client"
 	"github.com/cloudquery/cq-source-simple-analytics/resources"
 	"github.com/cloudquery/plugin-sdk/plugins/source"
@@ -15,10 +17,28 @@ func Plugin() *source.Plugin {
 	return source.NewPlugin(
 		"simple-analytics",
 		Version,
-		schema.Tables{
-			resources.Events(),
-			resources.PageViews(),
-		},
+		tables(),
 		client.New,
+		source.WithDynamicTableOption(dynamicTables),
 	)
 }
+
+// tables returns the static tables. The sync runs table comes last, as it waits for all others.
+func tables() schema.Tables {
+	return schema.Tables{
+		resources.Conversions(),
+		resources.Events(),
+		resources.PageViews(),
+		resources.Sessions(),
+		resources.SyncRuns(),
+	}
+}
+
+// dynamicTables adds the tables events are routed to via event_tables to the static tables,
+// before the sync runs table.
+func dynamicTables(_ context.Context, meta schema.ClientMeta) (schema.Tables, error) {
+	c := meta.(*client.Client)
+	static := tables()
+	syncRuns := static[len(static)-1]
+	return append(append(static[:len(static)-1], resources.EventTables(c.Spec)...), syncRuns), nil
+}
@@ -0,0 +1,119 @@
+package resources
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/transformers"
+	"golang.org/x/sync/errgroup"
+)
+
+const tableConversions = "simple_analytics_conversions"
+
+// Conversion is an event attributed to the first page view of its session.
+type Conversion struct {
+	Hostname           string
+	SessionID          string
+	EventName          string
+	ConvertedAt        time.Time
+	EventPath          string
+	Attributed         bool
+	LandingAt          *time.Time
+	LandingPath        string
+	LandingReferrer    string
+	LandingUTMCampaign string
+	LandingUTMContent  string
+	LandingUTMMedium   string
+	LandingUTMSource   string
+	LandingUTMTerm     string
+}
+
+func Conversions() *schema.Table {
+	return &schema.Table{
+		Name:        tableConversions,
+		Description: "Events listed in a website's `conversion_events`, attributed to the landing page and UTM values of the first page view in the same session.",
+		Resolver:    client.TrackSyncRun(fetchConversions),
+		Multiplex:   client.WebsiteMultiplex(tableConversions),
+		Transform: transformers.TransformWithStruct(
+			&Conversion{},
+		),
+		IsIncremental: true,
+	}
+}
+
+func fetchConversions(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	c := meta.(*client.Client)
+	if len(c.Website.ConversionEvents) == 0 {
+		return nil
+	}
+	names := make(map[string]bool, len(c.Website.ConversionEvents))
+	for _, name := range c.Website.ConversionEvents {
+		names[name] = true
+	}
+
+	start, err := c.StartTime(ctx, tableConversions)
+	if err != nil {
+		return err
+	}
+	end := c.EndTime(tableConversions)
+	c.Logger.Info().Time("start", start).Time("end", end).Msg("fetching data points for conversions")
+
+	// Both exports are read at the same time, as each is shared with other tables that read it at
+	// their own pace. Conversion events are kept until the sessions are complete, as page views of
+	// a session may arrive in any order. Sessions may have started before midnight, so we look one
+	// day further back for landing pages.
+	var sessions *sessionBuilder
+	var events []simpleanalytics.Event
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		sessions, err = buildSessions(gctx, c, start.AddDate(0, 0, -1), end)
+		return err
+	})
+	g.Go(func() error {
+		fields := []string{"added_iso", "added_unix", "datapoint", "hostname", "path", "session_id"}
+		return sharedEvents(c).read(gctx, c, start, end, fields, func(v simpleanalytics.Event) {
+			if names[v.Datapoint] {
+				events = append(events, v)
+			}
+		})
+	})
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	progress := client.Progress{Start: start, End: end}
+	for _, v := range events {
+		progress.Add(v.AddedUnix)
+		res <- newConversion(v, sessions.byID[v.SessionID])
+	}
+	return c.SaveCursor(ctx, tableConversions, progress)
+}
+
+// newConversion links an event to its session. The session may be nil if the
+// event has no session ID or its first page view is outside the synced window.
+func newConversion(e simpleanalytics.Event, s *Session) *Conversion {
+	conv := &Conversion{
+		Hostname:    e.Hostname,
+		SessionID:   e.SessionID,
+		EventName:   e.Datapoint,
+		ConvertedAt: e.AddedISO,
+		EventPath:   e.Path,
+	}
+	if s == nil {
+		return conv
+	}
+	landingAt := s.StartedAt
+	conv.Attributed = true
+	conv.LandingAt = &landingAt
+	conv.LandingPath = s.EntryPath
+	conv.LandingReferrer = s.EntryReferrer
+	conv.LandingUTMCampaign = s.UTMCampaign
+	conv.LandingUTMContent = s.UTMContent
+	conv.LandingUTMMedium = s.UTMMedium
+	conv.LandingUTMSource = s.UTMSource
+	conv.LandingUTMTerm = s.UTMTerm
+	return conv
+}
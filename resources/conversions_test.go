@@ -0,0 +1,95 @@
+package resources
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConversions(t *testing.T) {
+	pv := fakePageView(t)
+	ev := fakeEvent(t)
+	ev.Datapoint = "signup"
+	ev.SessionID = pv.SessionID
+	ts := newTestServer(t)
+	ts.AddPageViews(pv)
+	ts.AddEvents(ev)
+
+	client.TestHelper(t, Conversions(), ts.Server)
+}
+
+func TestConversionsProgress(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	for _, added := range []time.Time{
+		time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 1, 3, 12, 0, 0, 0, time.UTC),
+	} {
+		s.AddEvents(simpleanalytics.Event{Hostname: "test.com", Datapoint: "signup", AddedISO: added, AddedUnix: uint64(added.Unix())})
+	}
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites[0].ConversionEvents = []string{"signup"}
+
+	if got := client.TestSync(t, Conversions, s.Server, spec, b); len(got) != 2 {
+		t.Fatalf("expected 2 conversions, got %d", len(got))
+	}
+	value, err := b.Get(context.Background(), tableConversions, incrementalClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := client.ParseCursor(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(time.Date(2023, 1, 3, 12, 0, 0, 0, time.UTC).Unix()); cur.LastAddedUnix != want {
+		t.Errorf("unexpected high-water mark in cursor. got: %d, want: %d", cur.LastAddedUnix, want)
+	}
+	if cur.Stats.Rows != 2 {
+		t.Errorf("expected 2 rows in cursor stats, got %d", cur.Stats.Rows)
+	}
+}
+
+func TestNewConversion(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	e := simpleanalytics.Event{
+		Hostname:  "test.com",
+		SessionID: "a",
+		Datapoint: "signup",
+		AddedISO:  t0.Add(time.Minute),
+		Path:      "/signup",
+	}
+
+	got := newConversion(e, nil)
+	want := &Conversion{
+		Hostname:    "test.com",
+		SessionID:   "a",
+		EventName:   "signup",
+		ConvertedAt: t0.Add(time.Minute),
+		EventPath:   "/signup",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected unattributed conversion. diff: %s", diff)
+	}
+
+	s := &Session{
+		StartedAt:     t0,
+		EntryPath:     "/",
+		EntryReferrer: "https://google.com/",
+		UTMSource:     "newsletter",
+		UTMCampaign:   "launch",
+	}
+	got = newConversion(e, s)
+	want.Attributed = true
+	want.LandingAt = &t0
+	want.LandingPath = "/"
+	want.LandingReferrer = "https://google.com/"
+	want.LandingUTMSource = "newsletter"
+	want.LandingUTMCampaign = "launch"
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected attributed conversion. diff: %s", diff)
+	}
+}
@@ -0,0 +1,156 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/transformers"
+)
+
+var reInvalidColumnChars = regexp.MustCompile(`[^a-z\d_]+`)
+
+// metadataTypes maps the suffixes Simple Analytics uses for metadata fields to column types.
+var metadataTypes = map[string]schema.ValueType{
+	"_text": schema.TypeString,
+	"_int":  schema.TypeInt,
+	"_bool": schema.TypeBool,
+	"_date": schema.TypeTimestamp,
+}
+
+// EventTables returns one table per event routed via event_tables in any of the spec's websites, across accounts.
+// Metadata columns are the union of the metadata fields configured for the event across websites.
+func EventTables(spec client.Spec) schema.Tables {
+	fields := make(map[string]map[string]bool)
+	for _, w := range spec.AllWebsites() {
+		for _, et := range w.EventTables {
+			if fields[et.Event] == nil {
+				fields[et.Event] = make(map[string]bool)
+			}
+			for _, f := range et.MetadataFields {
+				fields[et.Event][f] = true
+			}
+		}
+	}
+	events := make([]string, 0, len(fields))
+	for event := range fields {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	tables := make(schema.Tables, 0, len(events))
+	for _, event := range events {
+		metadataFields := make([]string, 0, len(fields[event]))
+		for f := range fields[event] {
+			metadataFields = append(metadataFields, f)
+		}
+		sort.Strings(metadataFields)
+		tables = append(tables, EventTable(event, metadataFields))
+	}
+	return tables
+}
+
+// EventTable returns a table for a single routed event, with a typed column for each metadata field.
+func EventTable(event string, metadataFields []string) *schema.Table {
+	columns := []schema.Column{
+		{
+			Name:     "metadata",
+			Type:     schema.TypeJSON,
+			Resolver: schema.PathResolver("Metadata"),
+		},
+		{
+			Name:     "extra_fields",
+			Type:     schema.TypeJSON,
+			Resolver: schema.PathResolver("ExtraFields"),
+		},
+	}
+	names := make(map[string]bool, len(metadataFields))
+	for _, field := range metadataFields {
+		col := metadataColumn(field)
+		if names[col.Name] {
+			// fields that only differ by case or invalid characters share the column of the first one
+			continue
+		}
+		names[col.Name] = true
+		columns = append(columns, col)
+	}
+	columns = append(columns, userAgentColumns...)
+	return &schema.Table{
+		Name:        client.EventTableName(event),
+		Description: fmt.Sprintf("Events named %q, routed via `event_tables`. https://docs.simpleanalytics.com/api/export-data-points", event),
+		Resolver:    client.TrackSyncRun(fetchEventTable(event)),
+		Multiplex:   client.WebsiteMultiplex(client.EventTableName(event)),
+		Transform: transformers.TransformWithStruct(
+			&simpleanalytics.Event{},
+		),
+		Columns:              columns,
+		PostResourceResolver: resolveUserAgent,
+		IsIncremental:        true,
+	}
+}
+
+// metadataColumn returns the column of a metadata field. Its name keeps the type suffix of the
+// field, e.g. "metadata_plan_text", so that it never depends on the other configured fields.
+func metadataColumn(field string) schema.Column {
+	typ := schema.TypeJSON
+	for suffix, t := range metadataTypes {
+		if strings.HasSuffix(field, suffix) {
+			typ = t
+			break
+		}
+	}
+	return schema.Column{
+		Name: "metadata_" + reInvalidColumnChars.ReplaceAllString(strings.ToLower(field), "_"),
+		Type: typ,
+		Resolver: func(_ context.Context, _ schema.ClientMeta, r *schema.Resource, c schema.Column) error {
+			v, ok := r.Item.(simpleanalytics.Event).Metadata[field]
+			if !ok {
+				return nil
+			}
+			return r.Set(c.Name, v)
+		},
+	}
+}
+
+func fetchEventTable(event string) schema.TableResolver {
+	return func(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+		c := meta.(*client.Client)
+		et := c.Website.EventTable(event)
+		if et == nil || !c.Website.IncludesEvent(event) {
+			return nil
+		}
+		table := client.EventTableName(event)
+		start, err := c.StartTime(ctx, table)
+		if err != nil {
+			return err
+		}
+		end := c.EndTime(table)
+		hwm, err := c.HighWaterMark(ctx, table)
+		if err != nil {
+			return err
+		}
+		c.Logger.Info().Time("start", start).Time("end", end).Msg("fetching data points")
+
+		fields := make([]string, len(simpleanalytics.ExportFieldsEvents))
+		copy(fields, simpleanalytics.ExportFieldsEvents)
+		for _, field := range et.MetadataFields {
+			fields = append(fields, "metadata."+field)
+		}
+		progress := client.Progress{Start: start, End: end, HighWaterMark: hwm}
+		err = sharedEvents(c).read(ctx, c, start, end, fields, func(v simpleanalytics.Event) {
+			if v.Datapoint != event || progress.Skip(v.AddedUnix) {
+				return
+			}
+			progress.Add(v.AddedUnix)
+			res <- v
+		})
+		if err != nil {
+			return err
+		}
+		return c.SaveCursor(ctx, table, progress)
+	}
+}
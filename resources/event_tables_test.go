@@ -0,0 +1,156 @@
+package resources
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventTable(t *testing.T) {
+	ev := fakeEvent(t)
+	ev.Datapoint = "signup"
+	ev.Metadata = map[string]any{
+		"plan_text":   "pro",
+		"seats_int":   5,
+		"trial_bool":  true,
+		"renews_date": "2023-01-20T14:57:59.698Z",
+	}
+	ts := newTestServer(t)
+	ts.AddEvents(ev)
+
+	client.TestHelper(t, EventTable("signup", []string{"plan_text", "seats_int", "trial_bool", "renews_date"}), ts.Server)
+}
+
+func TestEventTables(t *testing.T) {
+	spec := client.Spec{
+		Websites: []client.WebsiteSpec{
+			{
+				Hostname: "a.com",
+				EventTables: []client.EventTableSpec{
+					{Event: "Sign Up", MetadataFields: []string{"plan_text", "plan_int"}},
+				},
+			},
+			{
+				Hostname: "b.com",
+				EventTables: []client.EventTableSpec{
+					{Event: "Sign Up", MetadataFields: []string{"referrer"}},
+					{Event: "purchase"},
+				},
+			},
+		},
+	}
+	tables := EventTables(spec)
+	got := make(map[string][]string)
+	for _, table := range tables {
+		got[table.Name] = nil
+		for _, c := range table.Columns {
+			got[table.Name] = append(got[table.Name], c.Name+":"+c.Type.String())
+		}
+	}
+	want := map[string][]string{
+		"simple_analytics_events_purchase": {
+			"metadata:" + schema.TypeJSON.String(),
+			"extra_fields:" + schema.TypeJSON.String(),
+			"ua_engine:" + schema.TypeString.String(),
+			"ua_device_brand:" + schema.TypeString.String(),
+			"ua_device_model:" + schema.TypeString.String(),
+			"ua_is_webview:" + schema.TypeBool.String(),
+		},
+		"simple_analytics_events_sign_up": {
+			"metadata:" + schema.TypeJSON.String(),
+			"extra_fields:" + schema.TypeJSON.String(),
+			"metadata_plan_int:" + schema.TypeInt.String(),
+			"metadata_plan_text:" + schema.TypeString.String(),
+			"metadata_referrer:" + schema.TypeJSON.String(),
+			"ua_engine:" + schema.TypeString.String(),
+			"ua_device_brand:" + schema.TypeString.String(),
+			"ua_device_model:" + schema.TypeString.String(),
+			"ua_is_webview:" + schema.TypeBool.String(),
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected event tables. diff: %s", diff)
+	}
+}
+
+func TestEventTableColumnNames(t *testing.T) {
+	names := func(fields ...string) []string {
+		var l []string
+		for _, c := range EventTable("signup", fields).Columns {
+			l = append(l, c.Name)
+		}
+		return l
+	}
+	// adding a field must not rename the columns of the others
+	before, after := names("plan_text"), names("plan_int", "plan_text")
+	for _, name := range before {
+		found := false
+		for _, other := range after {
+			found = found || other == name
+		}
+		if !found {
+			t.Errorf("column %s was renamed after adding a field, got %v", name, after)
+		}
+	}
+}
+
+func TestEventTablesSharedExport(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	for i, name := range []string{"signup", "login", "other", "signup"} {
+		added := time.Date(2023, 1, 2+i, 12, 0, 0, 0, time.UTC)
+		s.AddEvents(simpleanalytics.Event{Hostname: "test.com", Datapoint: name, AddedISO: added, AddedUnix: uint64(added.Unix())})
+	}
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites[0].EventTables = []client.EventTableSpec{{Event: "signup"}, {Event: "login"}}
+	rows := func(resources []*schema.Resource) []string {
+		var l []string
+		for _, r := range resources {
+			ev := r.Item.(simpleanalytics.Event)
+			l = append(l, r.Table.Name+"@"+ev.AddedISO.Format("2006-01-02"))
+		}
+		sort.Strings(l)
+		return l
+	}
+	exports := func() int {
+		n := 0
+		for _, r := range s.Requests() {
+			if r.Query["type"] == "events" {
+				n++
+			}
+		}
+		return n
+	}
+
+	got := client.TestSyncTables(t, EventTables(spec), s.Server, spec, b)
+	want := []string{
+		"simple_analytics_events_login@2023-01-03",
+		"simple_analytics_events_signup@2023-01-02",
+		"simple_analytics_events_signup@2023-01-05",
+	}
+	if diff := cmp.Diff(want, rows(got)); diff != "" {
+		t.Errorf("unexpected rows. diff: %s", diff)
+	}
+	if n := exports(); n != 1 {
+		t.Errorf("expected a single export for all event tables, got %d", n)
+	}
+
+	// Backfilling one table widens the shared export, but every table only gets its own window.
+	backfill := spec
+	backfill.Backfill = []client.BackfillSpec{{Table: client.EventTableName("signup"), StartDateStr: "2023-01-02", EndDateStr: "2023-01-02"}}
+	got = client.TestSyncTables(t, EventTables(backfill), s.Server, backfill, b)
+	if diff := cmp.Diff([]string{"simple_analytics_events_signup@2023-01-02"}, rows(got)); diff != "" {
+		t.Errorf("unexpected rows after backfill. diff: %s", diff)
+	}
+	if last := s.Requests()[len(s.Requests())-1]; last.Query["start"] != "2023-01-02" || last.Query["end"] != "2023-01-05" {
+		t.Errorf("expected the export to cover the windows of both tables, got %s..%s", last.Query["start"], last.Query["end"])
+	}
+	if n := exports(); n != 2 {
+		t.Errorf("expected a single export for the second sync, got %d", n-1)
+	}
+}
@@ -2,14 +2,11 @@ package resources
 
 import (
 	"context"
-	"fmt"
-	"time"
 
 	"github.com/cloudquery/cq-source-simple-analytics/client"
 	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
 	"github.com/cloudquery/plugin-sdk/schema"
 	"github.com/cloudquery/plugin-sdk/transformers"
-	"golang.org/x/sync/errgroup"
 )
 
 const tableEvents = "simple_analytics_events"
@@ -18,46 +15,43 @@ func Events() *schema.Table {
 	return &schema.Table{
 		Name:        tableEvents,
 		Description: "https://docs.simpleanalytics.com/api/export-data-points",
-		Resolver:    fetchEvents,
-		Multiplex:   client.WebsiteMultiplex,
+		Resolver:    client.TrackSyncRun(fetchEvents),
+		Multiplex:   client.WebsiteMultiplex(tableEvents),
 		Transform: transformers.TransformWithStruct(
 			&simpleanalytics.Event{},
 			// Not sure that this is guaranteed to be unique, and events don't always have UUIDs.
 			// Playing it safe and using _cq_id as the PK for now.
 			// transformers.WithPrimaryKeys("Hostname", "Datapoint", "AddedISO"),
 		),
-		Columns: []schema.Column{
+		Columns: append([]schema.Column{
 			{
 				Name:     "metadata",
 				Type:     schema.TypeJSON,
 				Resolver: schema.PathResolver("Metadata"),
 			},
-		},
-		IsIncremental: true,
+			{
+				Name:     "extra_fields",
+				Type:     schema.TypeJSON,
+				Resolver: schema.PathResolver("ExtraFields"),
+			},
+		}, userAgentColumns...),
+		PostResourceResolver: resolveUserAgent,
+		IsIncremental:        true,
 	}
 }
 
 func fetchEvents(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
 	c := meta.(*client.Client)
 
-	// Set start time according to these priorities:
-	// 1. backend state
-	// 2. start_time from plugin spec (which defaults to 2018)
-	start := c.Spec.StartTime()
-	if c.Backend != nil {
-		value, err := c.Backend.Get(ctx, tableEvents, c.ID())
-		if err != nil {
-			return fmt.Errorf("failed to get cursor from backend: %w", err)
-		}
-		if value != "" {
-			c.Logger.Info().Str("cursor", value).Msg("cursor found")
-			start, err = time.Parse(client.AllowedTimeLayout, value)
-			if err != nil {
-				return fmt.Errorf("failed to parse cursor from backend: %w", err)
-			}
-		}
+	start, err := c.StartTime(ctx, tableEvents)
+	if err != nil {
+		return err
+	}
+	end := c.EndTime(tableEvents)
+	hwm, err := c.HighWaterMark(ctx, tableEvents)
+	if err != nil {
+		return err
 	}
-	end := c.Spec.EndTime()
 	c.Logger.Info().Time("start", start).Time("end", end).Msg("fetching data points")
 
 	// Stream data points from Simple Analytics, from start time to now.
@@ -66,39 +60,19 @@ func fetchEvents(ctx context.Context, meta schema.ClientMeta, parent *schema.Res
 	for _, field := range c.Website.MetadataFields {
 		fields = append(fields, "metadata."+field)
 	}
-	opts := simpleanalytics.ExportOptions{
-		Hostname: c.Website.Hostname,
-		Start:    start,
-		End:      end,
-		Fields:   fields,
-	}
-	g, gctx := errgroup.WithContext(ctx)
-	var ch = make(chan simpleanalytics.Event)
-	g.Go(func() error {
-		defer close(ch)
-		return c.SAClient.ExportEvents(gctx, opts, ch)
-	})
-	for v := range ch {
+	progress := client.Progress{Start: start, End: end, HighWaterMark: hwm}
+	err = sharedEvents(c).read(ctx, c, start, end, fields, func(v simpleanalytics.Event) {
+		// Routed events are synced to their own tables instead.
+		if !c.Website.IncludesEvent(v.Datapoint) || c.Website.EventTable(v.Datapoint) != nil || progress.Skip(v.AddedUnix) {
+			return
+		}
+		progress.Add(v.AddedUnix)
 		res <- v
-	}
-	err := g.Wait()
+	})
 	if err != nil {
-		return fmt.Errorf("failed to fetch data points: %w", err)
+		return err
 	}
 
 	// Save cursor state to the backend.
-	if c.Backend != nil {
-		// We subtract a day from the end time to allow delayed data points
-		// to be fetched on the next sync. This will cause some duplicates, but
-		// allows us to guarantee at-least-once delivery. Duplicates can be removed
-		// by using overwrite-delete-stale write mode, by de-duplicating in queries,
-		// or by running a post-processing step.
-		newCursor := end.Add(-24 * time.Hour).Format(client.AllowedTimeLayout)
-		err = c.Backend.Set(ctx, tableEvents, c.ID(), newCursor)
-		if err != nil {
-			return fmt.Errorf("failed to save cursor to backend: %w", err)
-		}
-		c.Logger.Info().Str("cursor", newCursor).Msg("cursor updated")
-	}
-	return nil
+	return c.SaveCursor(ctx, tableEvents, progress)
 }
@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"golang.org/x/sync/errgroup"
+)
+
+// dayBufferSize is the number of rows buffered per day before the export of that day blocks.
+const dayBufferSize = 1000
+
+type exportFunc[T any] func(ctx context.Context, opts simpleanalytics.ExportOptions, out chan<- T) error
+
+// exportDays exports the rows of the window in opts to out. If concurrency is above one, every
+// day is exported separately by up to that many workers. Rows are still delivered in order of days:
+// a queue of per-day channels acts as a reorder buffer, and as both the queue and the channels are
+// bounded, workers block once they get too far ahead, which keeps memory usage bounded.
+//
+// In files mode the window is never split, as every export reads all files regardless of its window.
+func exportDays[T any](ctx context.Context, c *client.Client, opts simpleanalytics.ExportOptions, export exportFunc[T], out chan<- T) error {
+	concurrency := c.Spec.Concurrency
+	days := splitDays(opts.Start, opts.End, c.Spec.Location())
+	if concurrency <= 1 || len(days) <= 1 || c.Spec.Mode == client.ModeFiles {
+		return export(ctx, opts, out)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	workers := make(chan struct{}, concurrency)
+	queue := make(chan chan T, concurrency)
+	g.Go(func() error {
+		defer close(queue)
+		for _, day := range days {
+			select {
+			case workers <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			dayCh := make(chan T, dayBufferSize)
+			select {
+			case queue <- dayCh:
+			case <-gctx.Done():
+				<-workers
+				return gctx.Err()
+			}
+			dayOpts := opts
+			dayOpts.Start, dayOpts.End = day, day
+			g.Go(func() error {
+				defer func() { <-workers }()
+				defer close(dayCh)
+				return export(gctx, dayOpts, dayCh)
+			})
+		}
+		return nil
+	})
+	for dayCh := range queue {
+		for v := range dayCh {
+			// keep draining after a failure so that blocked workers can exit
+			if gctx.Err() == nil {
+				out <- v
+			}
+		}
+	}
+	return g.Wait()
+}
+
+// splitDays returns midnight of every day from start to end, inclusive, in loc.
+func splitDays(start, end time.Time, loc *time.Location) []time.Time {
+	y, m, d := start.In(loc).Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	var days []time.Time
+	for !day.After(end) {
+		days = append(days, day)
+		day = day.AddDate(0, 0, 1)
+	}
+	return days
+}
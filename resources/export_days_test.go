@@ -0,0 +1,193 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitDays(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := splitDays(time.Date(2023, 3, 24, 15, 0, 0, 0, berlin), time.Date(2023, 3, 27, 0, 0, 0, 0, berlin), berlin)
+	want := []time.Time{
+		time.Date(2023, 3, 24, 0, 0, 0, 0, berlin),
+		time.Date(2023, 3, 25, 0, 0, 0, 0, berlin),
+		time.Date(2023, 3, 26, 0, 0, 0, 0, berlin),
+		time.Date(2023, 3, 27, 0, 0, 0, 0, berlin),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected days. diff: %s", diff)
+	}
+	if got := splitDays(want[1], want[0], berlin); len(got) != 0 {
+		t.Errorf("expected no days if start is after end, got %v", got)
+	}
+}
+
+// fakeDayExport returns rowsPerDay rows per exported day, finishing later days first, and
+// records the maximum number of concurrent exports.
+type fakeDayExport struct {
+	rowsPerDay int
+	failOn     string
+
+	mu            sync.Mutex
+	running       int
+	maxConcurrent int
+	requests      int
+}
+
+func (f *fakeDayExport) export(ctx context.Context, opts simpleanalytics.ExportOptions, out chan<- string) error {
+	f.mu.Lock()
+	f.running++
+	f.requests++
+	if f.running > f.maxConcurrent {
+		f.maxConcurrent = f.running
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+
+	day := opts.Start.Format("2006-01-02")
+	if day == f.failOn {
+		return errors.New("boom")
+	}
+	// later days finish first, so rows would be out of order without reordering
+	time.Sleep(time.Duration(31-opts.Start.Day()) * time.Millisecond)
+	for i := 0; i < f.rowsPerDay; i++ {
+		select {
+		case out <- day:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func collect(t *testing.T, c *client.Client, f *fakeDayExport, start, end time.Time) ([]string, error) {
+	t.Helper()
+	ch := make(chan string)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		errCh <- exportDays(context.Background(), c, simpleanalytics.ExportOptions{Start: start, End: end}, f.export, ch)
+	}()
+	var got []string
+	for v := range ch {
+		got = append(got, v)
+	}
+	return got, <-errCh
+}
+
+func TestExportDays(t *testing.T) {
+	start, end := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		for i := 0; i < 3; i++ {
+			want = append(want, d.Format("2006-01-02"))
+		}
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		f := &fakeDayExport{rowsPerDay: 3}
+		c := &client.Client{Spec: client.Spec{Concurrency: concurrency}}
+		got, err := collect(t, c, f, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if concurrency == 1 {
+			// the whole window is exported at once, so the fake returns rows for the start date only
+			if f.requests != 1 {
+				t.Errorf("expected a single request without concurrency, got %d", f.requests)
+			}
+			continue
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("rows are not delivered in order of days. diff: %s", diff)
+		}
+		if f.requests != 10 {
+			t.Errorf("expected one request per day, got %d", f.requests)
+		}
+		if f.maxConcurrent > concurrency {
+			t.Errorf("expected at most %d concurrent exports, got %d", concurrency, f.maxConcurrent)
+		}
+	}
+
+	// in files mode, every export reads all files, so the window is not split
+	f := &fakeDayExport{rowsPerDay: 3}
+	c := &client.Client{Spec: client.Spec{Concurrency: 4, Mode: client.ModeFiles}}
+	if _, err := collect(t, c, f, start, end); err != nil {
+		t.Fatal(err)
+	}
+	if f.requests != 1 {
+		t.Errorf("expected a single export in files mode, got %d", f.requests)
+	}
+}
+
+func TestExportDaysBackPressure(t *testing.T) {
+	start, end := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 20, 0, 0, 0, 0, time.UTC)
+	f := &fakeDayExport{rowsPerDay: dayBufferSize + 1}
+	c := &client.Client{Spec: client.Spec{Concurrency: 2}}
+	ch := make(chan string)
+	go func() {
+		defer close(ch)
+		_ = exportDays(context.Background(), c, simpleanalytics.ExportOptions{Start: start, End: end}, f.export, ch)
+	}()
+	// Read a single row and stall: every started day fills its buffer and blocks, so no more than
+	// the workers and the queue allow may be started.
+	<-ch
+	time.Sleep(100 * time.Millisecond)
+	f.mu.Lock()
+	requests := f.requests
+	f.mu.Unlock()
+	if requests > 2*c.Spec.Concurrency+1 {
+		t.Errorf("expected exports to be throttled while rows are not consumed, got %d requests", requests)
+	}
+	for range ch {
+	}
+}
+
+func TestExportDaysError(t *testing.T) {
+	f := &fakeDayExport{rowsPerDay: 3, failOn: "2023-01-05"}
+	c := &client.Client{Spec: client.Spec{Concurrency: 3}}
+	got, err := collect(t, c, f, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, day := range got {
+		if day >= "2023-01-05" {
+			t.Errorf("expected no rows on or after the failed day, got %s", day)
+		}
+	}
+}
+
+func TestIncrementalConcurrency(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 5)
+	spec := incrementalSpec("2023-01-05")
+	spec.Concurrency = 3
+
+	got := client.TestSync(t, PageViews, s.Server, spec, b)
+	var order []string
+	for _, r := range got {
+		order = append(order, r.Item.(simpleanalytics.PageView).UUID)
+	}
+	if diff := cmp.Diff([]string{"2023-01-01", "2023-01-02", "2023-01-03", "2023-01-04", "2023-01-05"}, order); diff != "" {
+		t.Errorf("unexpected page views. diff: %s", diff)
+	}
+	if n := len(s.Requests()); n != 5 {
+		t.Errorf("expected one request per day, got %d", n)
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-04")
+}
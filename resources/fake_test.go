@@ -0,0 +1,55 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics/satest"
+	"github.com/cloudquery/plugin-sdk/faker"
+)
+
+// testUserAgent is parsed into non-empty values for all ua_* columns.
+const testUserAgent = "Mozilla/5.0 (Linux; Android 13; SM-G991B; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/108.0.5359.128 Mobile Safari/537.36"
+
+// newTestServer returns a fake server accepting the credentials used by client.TestHelper.
+func newTestServer(t *testing.T) *satest.Server {
+	t.Helper()
+	s := satest.NewServer("test", "test")
+	t.Cleanup(s.Close)
+	return s
+}
+
+// fakePageView returns a page view for the website used by client.TestHelper, within the synced date range.
+func fakePageView(t *testing.T) simpleanalytics.PageView {
+	t.Helper()
+	var pv simpleanalytics.PageView
+	if err := faker.FakeObject(&pv); err != nil {
+		t.Fatal(err)
+	}
+	pv.Hostname = "test.com"
+	pv.AddedISO = time.Now().UTC().AddDate(0, 0, -1).Truncate(time.Millisecond)
+	pv.UserAgent = testUserAgent
+	pv.Metadata = map[string]any{
+		"metadata_text": "bar",
+		"metadata_int":  123,
+	}
+	return pv
+}
+
+// fakeEvent returns an event for the website used by client.TestHelper, within the synced date range.
+func fakeEvent(t *testing.T) simpleanalytics.Event {
+	t.Helper()
+	var ev simpleanalytics.Event
+	if err := faker.FakeObject(&ev); err != nil {
+		t.Fatal(err)
+	}
+	ev.Hostname = "test.com"
+	ev.AddedISO = time.Now().UTC().AddDate(0, 0, -1).Truncate(time.Millisecond)
+	ev.UserAgent = testUserAgent
+	ev.Metadata = map[string]any{
+		"metadata_text": "bar",
+		"metadata_int":  123,
+	}
+	return ev
+}
@@ -0,0 +1,375 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics/satest"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/google/go-cmp/cmp"
+)
+
+const incrementalClientID = "simple-analytics:test.com"
+
+func incrementalSpec(end string) client.Spec {
+	return client.Spec{
+		UserID:       "test",
+		APIKey:       "test",
+		Websites:     []client.WebsiteSpec{{Hostname: "test.com"}},
+		StartDateStr: "2023-01-01",
+		EndDateStr:   end,
+	}
+}
+
+// addDailyPageViews adds one page view per day, at noon UTC, with the date as UUID.
+func addDailyPageViews(s *satest.Server, from, to int) {
+	for d := from; d <= to; d++ {
+		s.AddPageViews(simpleanalytics.PageView{
+			Hostname: "test.com",
+			UUID:     fmt.Sprintf("2023-01-%02d", d),
+			AddedISO: time.Date(2023, 1, d, 12, 0, 0, 0, time.UTC),
+		})
+	}
+}
+
+func uuids(resources []*schema.Resource) []string {
+	l := make([]string, 0, len(resources))
+	for _, r := range resources {
+		l = append(l, r.Item.(simpleanalytics.PageView).UUID)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// cursorNext returns the date the next sync of the table starts from, or "" if there is no cursor.
+func cursorNext(t *testing.T, b *client.MemoryBackend, table, clientID string) string {
+	t.Helper()
+	value, err := b.Get(context.Background(), table, clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == "" {
+		return ""
+	}
+	cur, err := client.ParseCursor(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cur.Next
+}
+
+func assertCursor(t *testing.T, b *client.MemoryBackend, table, want string) {
+	t.Helper()
+	if got := cursorNext(t, b, table, incrementalClientID); got != want {
+		t.Errorf("unexpected cursor for %s. got: %q, want: %q", table, got, want)
+	}
+}
+
+func assertLastRequest(t *testing.T, s *satest.Server, start, end string) {
+	t.Helper()
+	reqs := s.Requests()
+	last := reqs[len(reqs)-1]
+	if last.Query["start"] != start || last.Query["end"] != end {
+		t.Errorf("unexpected date range in request. got: %s..%s, want: %s..%s", last.Query["start"], last.Query["end"], start, end)
+	}
+}
+
+func TestIncrementalPageViews(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 5)
+	seen := make(map[string]int)
+
+	// First run: no cursor, so everything since start_date is synced.
+	got := client.TestSync(t, PageViews, s.Server, incrementalSpec("2023-01-05"), b)
+	assertLastRequest(t, s, "2023-01-01", "2023-01-05")
+	if diff := cmp.Diff([]string{"2023-01-01", "2023-01-02", "2023-01-03", "2023-01-04", "2023-01-05"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected page views in first run. diff: %s", diff)
+	}
+	for _, id := range uuids(got) {
+		seen[id]++
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-04")
+
+	// Second run: resumes from the cursor, one day before the previous end date, so the last
+	// two days are synced again and the late-arriving page view for the 4th is picked up.
+	s.AddPageViews(simpleanalytics.PageView{Hostname: "test.com", UUID: "2023-01-04-late", AddedISO: time.Date(2023, 1, 4, 23, 0, 0, 0, time.UTC)})
+	addDailyPageViews(s, 6, 7)
+	got = client.TestSync(t, PageViews, s.Server, incrementalSpec("2023-01-07"), b)
+	assertLastRequest(t, s, "2023-01-04", "2023-01-07")
+	if diff := cmp.Diff([]string{"2023-01-04", "2023-01-04-late", "2023-01-05", "2023-01-06", "2023-01-07"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected page views in second run. diff: %s", diff)
+	}
+	for _, id := range uuids(got) {
+		seen[id]++
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-06")
+
+	// Failed run: the cursor must not advance.
+	s.InjectError(http.StatusInternalServerError, "boom")
+	client.TestSync(t, PageViews, s.Server, incrementalSpec("2023-01-10"), b)
+	assertCursor(t, b, tablePageViews, "2023-01-06")
+
+	// Next run resumes from where the last successful run left off.
+	addDailyPageViews(s, 8, 10)
+	got = client.TestSync(t, PageViews, s.Server, incrementalSpec("2023-01-10"), b)
+	assertLastRequest(t, s, "2023-01-06", "2023-01-10")
+	for _, id := range uuids(got) {
+		seen[id]++
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+
+	// Every page view was delivered at least once, and only the lookback window was delivered
+	// twice, so de-duplicating on the primary key (hostname, uuid) yields exactly the stored data.
+	wantSeen := map[string]int{
+		"2023-01-01": 1, "2023-01-02": 1, "2023-01-03": 1,
+		"2023-01-04": 2, "2023-01-04-late": 1, "2023-01-05": 2,
+		"2023-01-06": 2, "2023-01-07": 2,
+		"2023-01-08": 1, "2023-01-09": 1, "2023-01-10": 1,
+	}
+	if diff := cmp.Diff(wantSeen, seen); diff != "" {
+		t.Errorf("unexpected delivery counts across runs. diff: %s", diff)
+	}
+}
+
+func TestIncrementalCursorsPerTable(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 3)
+
+	client.TestSync(t, PageViews, s.Server, incrementalSpec("2023-01-03"), b)
+	assertCursor(t, b, tablePageViews, "2023-01-02")
+	assertCursor(t, b, tableEvents, "")
+
+	// The events table has its own cursor and starts from start_date.
+	client.TestSync(t, Events, s.Server, incrementalSpec("2023-01-05"), b)
+	assertLastRequest(t, s, "2023-01-01", "2023-01-05")
+	assertCursor(t, b, tableEvents, "2023-01-04")
+	assertCursor(t, b, tablePageViews, "2023-01-02")
+}
+
+func TestIncrementalWebsiteOverrides(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites = []client.WebsiteSpec{
+		{Hostname: "test.com"},
+		{Hostname: "new.com", StartDateStr: "2019-01-01", LookbackStr: "0d"},
+		{Hostname: "events.com", Tables: []string{tableEvents}},
+		{Hostname: "old.com", EndDateStr: "2023-01-02", LookbackStr: "1w"},
+	}
+	client.TestSync(t, PageViews, s.Server, spec, b)
+
+	got := make(map[string]string)
+	for _, r := range s.Requests() {
+		got[r.Query["hostname"]] = r.Query["start"] + ".." + r.Query["end"]
+	}
+	want := map[string]string{
+		"test.com": "2023-01-01..2023-01-05",
+		"new.com":  "2019-01-01..2023-01-05",
+		"old.com":  "2023-01-01..2023-01-02",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected date ranges per website. diff: %s", diff)
+	}
+
+	cursors := make(map[string]string)
+	for _, hostname := range []string{"test.com", "new.com", "events.com", "old.com"} {
+		cursors[hostname] = cursorNext(t, b, tablePageViews, "simple-analytics:"+hostname)
+	}
+	wantCursors := map[string]string{
+		"test.com":   "2023-01-04",
+		"new.com":    "2023-01-05",
+		"events.com": "",
+		"old.com":    "2022-12-26",
+	}
+	if diff := cmp.Diff(wantCursors, cursors); diff != "" {
+		t.Errorf("unexpected cursors per website. diff: %s", diff)
+	}
+}
+
+func TestIncrementalConfigChange(t *testing.T) {
+	tests := []struct {
+		policy    client.ConfigChangePolicy
+		wantStart string
+	}{
+		{policy: client.ConfigChangeBackfill, wantStart: "2023-01-01"},
+		{policy: client.ConfigChangeWarn, wantStart: "2023-01-04"},
+		{policy: client.ConfigChangeKeep, wantStart: "2023-01-04"},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			s := newTestServer(t)
+			b := client.NewMemoryBackend()
+			addDailyPageViews(s, 1, 5)
+
+			spec := incrementalSpec("2023-01-05")
+			spec.OnConfigChange = tc.policy
+			client.TestSync(t, PageViews, s.Server, spec, b)
+
+			// An unchanged configuration resumes from the cursor regardless of the policy.
+			client.TestSync(t, PageViews, s.Server, spec, b)
+			assertLastRequest(t, s, "2023-01-04", "2023-01-05")
+
+			spec.Websites[0].MetadataFields = []string{"plan_text"}
+			client.TestSync(t, PageViews, s.Server, spec, b)
+			assertLastRequest(t, s, tc.wantStart, "2023-01-05")
+			assertCursor(t, b, tablePageViews, "2023-01-04")
+
+			// The new fingerprint is saved with the cursor, so the next sync resumes from it.
+			client.TestSync(t, PageViews, s.Server, spec, b)
+			assertLastRequest(t, s, "2023-01-04", "2023-01-05")
+		})
+	}
+}
+
+func TestIncrementalLegacyCursorWithoutFingerprint(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 5)
+	if err := b.Set(context.Background(), tablePageViews, incrementalClientID, "2023-01-03"); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := incrementalSpec("2023-01-05")
+	spec.OnConfigChange = client.ConfigChangeBackfill
+	client.TestSync(t, PageViews, s.Server, spec, b)
+	assertLastRequest(t, s, "2023-01-03", "2023-01-05")
+
+	// The legacy cursor is migrated to the current format.
+	value, err := b.Get(context.Background(), tablePageViews, incrementalClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := client.ParseCursor(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.Version != client.CursorVersion || cur.Next != "2023-01-04" || cur.WindowStart != "2023-01-03" || cur.WindowEnd != "2023-01-05" || cur.Fingerprint == "" {
+		t.Errorf("unexpected migrated cursor: %s", value)
+	}
+}
+
+func TestIncrementalHighWaterMark(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addHourly := func(from, to int) {
+		for h := from; h <= to; h++ {
+			added := time.Date(2023, 1, 5, h, 0, 0, 0, time.UTC)
+			s.AddPageViews(simpleanalytics.PageView{
+				Hostname:  "test.com",
+				UUID:      fmt.Sprintf("%02dh", h),
+				AddedISO:  added,
+				AddedUnix: uint64(added.Unix()),
+			})
+		}
+	}
+	spec := incrementalSpec("2023-01-05")
+
+	addHourly(0, 9)
+	got := client.TestSync(t, PageViews, s.Server, spec, b)
+	if len(got) != 10 {
+		t.Fatalf("expected all 10 page views in the first run, got %d", len(got))
+	}
+
+	// A page view added at 08:30 arrives late. Everything up to the high-water mark (09:00) minus
+	// the default safety margin of an hour is skipped, even though the whole day is downloaded again.
+	late := time.Date(2023, 1, 5, 8, 30, 0, 0, time.UTC)
+	s.AddPageViews(simpleanalytics.PageView{Hostname: "test.com", UUID: "08h30-late", AddedISO: late, AddedUnix: uint64(late.Unix())})
+	addHourly(10, 12)
+	got = client.TestSync(t, PageViews, s.Server, spec, b)
+	assertLastRequest(t, s, "2023-01-04", "2023-01-05")
+	if diff := cmp.Diff([]string{"08h30-late", "09h", "10h", "11h", "12h"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected page views in second run. diff: %s", diff)
+	}
+
+	// A safety margin of 0 skips everything up to the high-water mark.
+	spec.SafetyMarginStr = "0s"
+	addHourly(13, 13)
+	got = client.TestSync(t, PageViews, s.Server, spec, b)
+	if diff := cmp.Diff([]string{"13h"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected page views in third run. diff: %s", diff)
+	}
+
+	// Backfilling after a config change ignores the high-water mark.
+	spec.OnConfigChange = client.ConfigChangeBackfill
+	spec.Websites[0].MetadataFields = []string{"plan_text"}
+	got = client.TestSync(t, PageViews, s.Server, spec, b)
+	if len(got) != 15 {
+		t.Errorf("expected all 15 page views when backfilling, got %d", len(got))
+	}
+}
+
+func TestIncrementalBackfill(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 10)
+	spec := incrementalSpec("2023-01-10")
+	spec.Websites = append(spec.Websites, client.WebsiteSpec{Hostname: "other.com"})
+	client.TestSync(t, PageViews, s.Server, spec, b)
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+
+	// Backfill a window for one website only, keeping its cursor.
+	backfill := spec
+	backfill.Backfill = []client.BackfillSpec{{Website: "test.com", Table: tablePageViews, StartDateStr: "2023-01-02", EndDateStr: "2023-01-03", KeepCursor: true}}
+	got := client.TestSync(t, PageViews, s.Server, backfill, b)
+	if diff := cmp.Diff([]string{"2023-01-02", "2023-01-03"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected backfilled page views. diff: %s", diff)
+	}
+	ranges := make(map[string]string)
+	for _, r := range s.Requests()[2:] {
+		ranges[r.Query["hostname"]] = r.Query["start"] + ".." + r.Query["end"]
+	}
+	if diff := cmp.Diff(map[string]string{"test.com": "2023-01-02..2023-01-03", "other.com": "2023-01-09..2023-01-10"}, ranges); diff != "" {
+		t.Errorf("unexpected date ranges per website. diff: %s", diff)
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+
+	// Without keep_cursor, backfilling a past window does not move the cursor back.
+	backfill.Backfill[0].KeepCursor = false
+	client.TestSync(t, PageViews, s.Server, backfill, b)
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+	got = client.TestSync(t, PageViews, s.Server, spec, b)
+	if diff := cmp.Diff([]string{"2023-01-09", "2023-01-10"}, uuids(got)); diff != "" {
+		t.Errorf("expected the next sync to resume from the cursor. diff: %s", diff)
+	}
+
+	// Neither does a backfill with only an end, from the start date.
+	backfill.Backfill[0].StartDateStr = ""
+	got = client.TestSync(t, PageViews, s.Server, backfill, b)
+	if diff := cmp.Diff([]string{"2023-01-01", "2023-01-02", "2023-01-03"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected backfilled page views. diff: %s", diff)
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+
+	// A backfill of the whole date range saves the cursor, unless keep_cursor is set.
+	if err := b.Set(context.Background(), tablePageViews, incrementalClientID, "2023-01-05"); err != nil {
+		t.Fatal(err)
+	}
+	backfill.Backfill[0].EndDateStr = ""
+	backfill.Backfill[0].KeepCursor = true
+	client.TestSync(t, PageViews, s.Server, backfill, b)
+	assertCursor(t, b, tablePageViews, "2023-01-05")
+	backfill.Backfill[0].KeepCursor = false
+	got = client.TestSync(t, PageViews, s.Server, backfill, b)
+	if len(got) != 10 {
+		t.Errorf("expected all 10 page views when backfilling the whole date range, got %d", len(got))
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+
+	// reset_cursor syncs everything again from the start date and saves the cursor.
+	reset := spec
+	reset.ResetCursor = true
+	got = client.TestSync(t, PageViews, s.Server, reset, b)
+	assertLastRequest(t, s, "2023-01-01", "2023-01-10")
+	if len(got) != 10 {
+		t.Errorf("expected all 10 page views after resetting the cursor, got %d", len(got))
+	}
+	assertCursor(t, b, tablePageViews, "2023-01-09")
+}
@@ -1,32 +1,68 @@
 package resources
 
 import (
-	"encoding/json"
-	"net/http"
-	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cloudquery/cq-source-simple-analytics/client"
 	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
-	"github.com/cloudquery/plugin-sdk/faker"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestPageViews(t *testing.T) {
-	var pv simpleanalytics.PageView
-	if err := faker.FakeObject(&pv); err != nil {
+	ts := newTestServer(t)
+	ts.AddPageViews(fakePageView(t))
+
+	client.TestHelper(t, PageViews(), ts.Server)
+}
+
+func TestPageViewsCSV(t *testing.T) {
+	s := newTestServer(t)
+	addDailyPageViews(s, 1, 3)
+	spec := incrementalSpec("2023-01-03")
+
+	var items [2][]any
+	for i, format := range []simpleanalytics.Format{simpleanalytics.FormatNDJSON, simpleanalytics.FormatCSV} {
+		spec.Format = format
+		for _, r := range client.TestSync(t, PageViews, s.Server, spec, client.NewMemoryBackend()) {
+			items[i] = append(items[i], r.Item)
+		}
+	}
+	if len(items[0]) != 3 {
+		t.Fatalf("expected 3 page views, got %d", len(items[0]))
+	}
+	if diff := cmp.Diff(items[0], items[1]); diff != "" {
+		t.Errorf("page views synced as CSV differ from NDJSON. diff: %s", diff)
+	}
+	if f := s.Requests()[1].Query["format"]; f != "csv" {
+		t.Errorf("unexpected format in request. got: %s, want: csv", f)
+	}
+}
+
+func TestPageViewsFiles(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	rows := `{"added_iso":"2023-01-02T12:00:00Z","hostname":"test.com","uuid":"2023-01-02"}` + "\n" +
+		`{"added_iso":"2023-01-02T13:00:00Z","hostname":"other.com","uuid":"other"}` + "\n" +
+		`{"added_iso":"2023-01-02T14:00:00Z","hostname":"test.com","datapoint":"signup","uuid":"event"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "2023-01.ndjson"), []byte(rows), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	pv.Metadata = map[string]any{
-		"metadata.foo_text": "bar",
-		"metadata.bar_int":  123,
-		"metadata.baz_date": "2021-01-01T00:00:00Z",
+	csv := "added_iso,hostname,uuid\n2023-01-03T12:00:00Z,test.com,2023-01-03\n2023-01-09T12:00:00Z,test.com,2023-01-09\n"
+	if err := os.WriteFile(filepath.Join(dir, "2023-01.csv"), []byte(csv), 0o644); err != nil {
+		t.Fatal(err)
 	}
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/x-ndjson")
-		d, _ := json.Marshal(pv)
-		_, _ = w.Write(d)
-	}))
-	defer ts.Close()
+	spec := incrementalSpec("2023-01-05")
+	spec.Mode = client.ModeFiles
+	spec.UserID, spec.APIKey = "", ""
+	spec.Websites[0].Files = dir
 
-	client.TestHelper(t, PageViews(), ts)
+	got := client.TestSync(t, PageViews, s.Server, spec, client.NewMemoryBackend())
+	if diff := cmp.Diff([]string{"2023-01-02", "2023-01-03"}, uuids(got)); diff != "" {
+		t.Errorf("unexpected page views. diff: %s", diff)
+	}
+	if n := len(s.Requests()); n != 0 {
+		t.Errorf("expected no API requests in files mode, got %d", n)
+	}
 }
@@ -0,0 +1,169 @@
+package resources
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/transformers"
+)
+
+const tableSessions = "simple_analytics_sessions"
+
+// sessionFields are the page view fields needed to reconstruct sessions.
+var sessionFields = []string{
+	"added_iso",
+	"document_referrer",
+	"duration_seconds",
+	"hostname",
+	"path",
+	"session_id",
+	"utm_campaign",
+	"utm_content",
+	"utm_medium",
+	"utm_source",
+	"utm_term",
+}
+
+// Session is a visit reconstructed from the page views that share a session ID.
+type Session struct {
+	Hostname        string
+	SessionID       string
+	StartedAt       time.Time
+	EndedAt         time.Time
+	EntryPath       string
+	ExitPath        string
+	EntryReferrer   string
+	PageViews       int64
+	DurationSeconds float64
+	IsBounce        bool
+	UTMCampaign     string
+	UTMContent      string
+	UTMMedium       string
+	UTMSource       string
+	UTMTerm         string
+}
+
+func Sessions() *schema.Table {
+	return &schema.Table{
+		Name:        tableSessions,
+		Description: "Sessions reconstructed from page views sharing the same session_id. Landing page and UTM values are taken from the first page view of the session. Page views are read from the export shared with the simple_analytics_page_views table, so syncing both downloads them once.",
+		Resolver:    client.TrackSyncRun(fetchSessions),
+		Multiplex:   client.WebsiteMultiplex(tableSessions),
+		Transform: transformers.TransformWithStruct(
+			&Session{},
+			transformers.WithPrimaryKeys("Hostname", "SessionID"),
+		),
+		IsIncremental: true,
+	}
+}
+
+func fetchSessions(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	c := meta.(*client.Client)
+
+	start, err := c.StartTime(ctx, tableSessions)
+	if err != nil {
+		return err
+	}
+	end := c.EndTime(tableSessions)
+	c.Logger.Info().Time("start", start).Time("end", end).Msg("fetching page views for sessions")
+
+	// Sessions may have started before midnight, so we look one day further back for their first
+	// page views. Otherwise, a session that started before the window would be rebuilt from its later
+	// page views only, and overwrite the complete session synced before.
+	b, err := buildSessions(ctx, c, start.AddDate(0, 0, -1), end)
+	if err != nil {
+		return err
+	}
+
+	// Sessions are only emitted once the page view stream for the window is complete,
+	// as page views of a session may arrive in any order. Sessions that ended before the
+	// window were synced before.
+	progress := client.Progress{Start: start, End: end}
+	for _, s := range b.sessions() {
+		if s.EndedAt.Before(start) {
+			continue
+		}
+		progress.Add(uint64(s.StartedAt.Unix()))
+		res <- s
+	}
+	return c.SaveCursor(ctx, tableSessions, progress)
+}
+
+// buildSessions reads all page views between start and end from the shared export and folds
+// them into sessions.
+func buildSessions(ctx context.Context, c *client.Client, start, end time.Time) (*sessionBuilder, error) {
+	b := newSessionBuilder()
+	if err := sharedPageViews(c).read(ctx, c, start, end, sessionFields, b.add); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type sessionBuilder struct {
+	byID map[string]*Session
+}
+
+func newSessionBuilder() *sessionBuilder {
+	return &sessionBuilder{byID: make(map[string]*Session)}
+}
+
+// add folds a page view into its session. Page views without a session ID are ignored.
+func (b *sessionBuilder) add(pv simpleanalytics.PageView) {
+	if pv.SessionID == "" {
+		return
+	}
+	end := pv.AddedISO.Add(time.Duration(pv.DurationSeconds * float64(time.Second)))
+	s, ok := b.byID[pv.SessionID]
+	if !ok {
+		s = &Session{
+			Hostname:  pv.Hostname,
+			SessionID: pv.SessionID,
+			StartedAt: pv.AddedISO,
+			EndedAt:   end,
+			ExitPath:  pv.Path,
+		}
+		setEntry(s, pv)
+		b.byID[pv.SessionID] = s
+	} else {
+		if pv.AddedISO.Before(s.StartedAt) {
+			s.StartedAt = pv.AddedISO
+			setEntry(s, pv)
+		}
+		if !end.Before(s.EndedAt) {
+			s.EndedAt = end
+			s.ExitPath = pv.Path
+		}
+	}
+	s.PageViews++
+	s.DurationSeconds += pv.DurationSeconds
+	s.IsBounce = s.PageViews == 1
+}
+
+func setEntry(s *Session, pv simpleanalytics.PageView) {
+	s.EntryPath = pv.Path
+	s.EntryReferrer = pv.DocumentReferrer
+	s.UTMCampaign = pv.UTMCampaign
+	s.UTMContent = pv.UTMContent
+	s.UTMMedium = pv.UTMMedium
+	s.UTMSource = pv.UTMSource
+	s.UTMTerm = pv.UTMTerm
+}
+
+// sessions returns all sessions ordered by start time.
+func (b *sessionBuilder) sessions() []*Session {
+	l := make([]*Session, 0, len(b.byID))
+	for _, s := range b.byID {
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].StartedAt.Equal(l[j].StartedAt) {
+			return l[i].SessionID < l[j].SessionID
+		}
+		return l[i].StartedAt.Before(l[j].StartedAt)
+	})
+	return l
+}
@@ -0,0 +1,91 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSessions(t *testing.T) {
+	pv := fakePageView(t)
+	pv.DurationSeconds = 12
+	ts := newTestServer(t)
+	ts.AddPageViews(pv)
+
+	client.TestHelper(t, Sessions(), ts.Server)
+}
+
+func TestSessionBuilder(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	pageViews := []simpleanalytics.PageView{
+		// delivered out of order on purpose
+		{Hostname: "test.com", SessionID: "a", AddedISO: t0.Add(time.Minute), Path: "/pricing", DurationSeconds: 30},
+		{Hostname: "test.com", SessionID: "a", AddedISO: t0, Path: "/", DocumentReferrer: "https://google.com/", UTMSource: "newsletter", UTMCampaign: "launch", DurationSeconds: 20},
+		{Hostname: "test.com", SessionID: "b", AddedISO: t0.Add(time.Hour), Path: "/blog", DurationSeconds: 5},
+		{Hostname: "test.com", SessionID: "", AddedISO: t0, Path: "/ignored"},
+	}
+	b := newSessionBuilder()
+	for _, pv := range pageViews {
+		b.add(pv)
+	}
+	want := []*Session{
+		{
+			Hostname:        "test.com",
+			SessionID:       "a",
+			StartedAt:       t0,
+			EndedAt:         t0.Add(time.Minute + 30*time.Second),
+			EntryPath:       "/",
+			ExitPath:        "/pricing",
+			EntryReferrer:   "https://google.com/",
+			PageViews:       2,
+			DurationSeconds: 50,
+			IsBounce:        false,
+			UTMCampaign:     "launch",
+			UTMSource:       "newsletter",
+		},
+		{
+			Hostname:        "test.com",
+			SessionID:       "b",
+			StartedAt:       t0.Add(time.Hour),
+			EndedAt:         t0.Add(time.Hour + 5*time.Second),
+			EntryPath:       "/blog",
+			ExitPath:        "/blog",
+			PageViews:       1,
+			DurationSeconds: 5,
+			IsBounce:        true,
+		},
+	}
+	if diff := cmp.Diff(want, b.sessions()); diff != "" {
+		t.Errorf("unexpected sessions. diff: %s", diff)
+	}
+}
+
+func TestIncrementalSessions(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	for _, pv := range []struct {
+		session, path string
+		added         time.Time
+	}{
+		{"earlier", "/", time.Date(2023, 1, 2, 10, 0, 0, 0, time.UTC)},
+		{"midnight", "/landing", time.Date(2023, 1, 2, 23, 50, 0, 0, time.UTC)},
+		{"midnight", "/pricing", time.Date(2023, 1, 3, 0, 10, 0, 0, time.UTC)},
+	} {
+		s.AddPageViews(simpleanalytics.PageView{Hostname: "test.com", SessionID: pv.session, Path: pv.path, AddedISO: pv.added, AddedUnix: uint64(pv.added.Unix())})
+	}
+	client.TestSync(t, Sessions, s.Server, incrementalSpec("2023-01-04"), b)
+	assertCursor(t, b, tableSessions, "2023-01-03")
+
+	// The next sync starts from the cursor, after the session started, but still rebuilds it completely.
+	got := client.TestSync(t, Sessions, s.Server, incrementalSpec("2023-01-06"), b)
+	if len(got) != 1 {
+		t.Fatalf("expected only the session within the window, got %d sessions", len(got))
+	}
+	session := got[0].Item.(*Session)
+	if session.SessionID != "midnight" || session.EntryPath != "/landing" || session.PageViews != 2 || session.IsBounce {
+		t.Errorf("unexpected session %+v", session)
+	}
+}
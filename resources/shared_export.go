@@ -0,0 +1,348 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"golang.org/x/sync/errgroup"
+)
+
+// sharedExportGrace is how long a shared export waits for all tables expected to read it before
+// it starts without the missing ones. Tables only take that long to start if the scheduler has no
+// table slot left for them, e.g. with a low plugin concurrency, in which case waiting for them any
+// longer would deadlock the sync.
+var sharedExportGrace = 2 * time.Second
+
+// readerBufferSize is the number of rows buffered for each table reading a shared export. The
+// export blocks while the buffer of a table is full, which keeps memory usage bounded.
+const readerBufferSize = 1000
+
+// sharedExport is an export of the page views or events of a website that several tables read at
+// the same time, so that it is downloaded once per sync instead of once per table. It streams the
+// union of the windows and fields of its readers, and every reader gets the rows of its own window.
+//
+// A reader that starts while the export is running gets the rows of the responses, i.e. days,
+// that follow, and exports the days it missed itself, so that no reader ever waits for another.
+type sharedExport[T any] struct {
+	exportType string
+	export     exportFunc[T]
+	added      func(T) time.Time
+	expected   int
+
+	mu       sync.Mutex
+	readers  []*exportReader[T]
+	started  bool
+	finished bool
+	all      chan struct{} // closed once all expected readers started
+	end      time.Time     // end of the streamed window
+	fields   map[string]bool
+	err      error
+}
+
+// exportReader is a table reading a shared export.
+type exportReader[T any] struct {
+	c          *client.Client
+	start, end time.Time
+	fields     []string
+	rows       chan T
+	done       chan struct{} // closed when the table stops reading
+
+	// from is the start of the first response streamed to the reader, if streamed is set.
+	streamed bool
+	from     time.Time
+}
+
+// sharedPageViews returns the page views export shared by the tables of the client's website.
+func sharedPageViews(c *client.Client) *sharedExport[simpleanalytics.PageView] {
+	v, _ := c.Shared("pageviews", func() (any, error) {
+		expected := 0
+		for _, table := range []string{tablePageViews, tableSessions} {
+			if c.SyncsTable(table) {
+				expected++
+			}
+		}
+		if syncsConversions(c) {
+			expected++
+		}
+		added := func(v simpleanalytics.PageView) time.Time { return v.AddedISO }
+		return newSharedExport("pageviews", c.SAClient.ExportPageViews, added, expected), nil
+	})
+	return v.(*sharedExport[simpleanalytics.PageView])
+}
+
+// sharedEvents returns the events export shared by the tables of the client's website.
+func sharedEvents(c *client.Client) *sharedExport[simpleanalytics.Event] {
+	v, _ := c.Shared("events", func() (any, error) {
+		expected := 0
+		if c.SyncsTable(tableEvents) {
+			expected++
+		}
+		if syncsConversions(c) {
+			expected++
+		}
+		for _, et := range c.Website.EventTables {
+			if c.SyncsTable(client.EventTableName(et.Event)) && c.Website.IncludesEvent(et.Event) {
+				expected++
+			}
+		}
+		added := func(v simpleanalytics.Event) time.Time { return v.AddedISO }
+		return newSharedExport("events", c.SAClient.ExportEvents, added, expected), nil
+	})
+	return v.(*sharedExport[simpleanalytics.Event])
+}
+
+// syncsConversions reports whether the conversions table reads the exports of the client's website.
+func syncsConversions(c *client.Client) bool {
+	return c.SyncsTable(tableConversions) && len(c.Website.ConversionEvents) > 0
+}
+
+func newSharedExport[T any](exportType string, export exportFunc[T], added func(T) time.Time, expected int) *sharedExport[T] {
+	return &sharedExport[T]{
+		exportType: exportType,
+		export:     export,
+		added:      added,
+		expected:   expected,
+		all:        make(chan struct{}),
+	}
+}
+
+// exportRow is a row of a shared export, or the end of a response if stats is set.
+type exportRow[T any] struct {
+	start time.Time // start of the response, i.e. the day if the window is split into days
+	v     T
+	stats *simpleanalytics.TransferStats
+}
+
+// markResponses wraps export to tag every row with the start of its response, and to end every
+// response with its transfer stats, so that they can be split between the tables that read it.
+func markResponses[T any](export exportFunc[T]) exportFunc[exportRow[T]] {
+	return func(ctx context.Context, opts simpleanalytics.ExportOptions, out chan<- exportRow[T]) error {
+		var stats *simpleanalytics.TransferStats
+		opts.OnTransfer = func(s simpleanalytics.TransferStats) { stats = &s }
+		g, gctx := errgroup.WithContext(ctx)
+		var ch = make(chan T)
+		g.Go(func() error {
+			defer close(ch)
+			return export(gctx, opts, ch)
+		})
+		for v := range ch {
+			out <- exportRow[T]{start: opts.Start, v: v}
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		if stats != nil {
+			out <- exportRow[T]{start: opts.Start, stats: stats}
+		}
+		return nil
+	}
+}
+
+// read calls fn with the rows of the given window, from the shared export as far as it covers the
+// window, and from exports of the table's own otherwise.
+func (s *sharedExport[T]) read(ctx context.Context, c *client.Client, start, end time.Time, fields []string, fn func(T)) error {
+	r := s.subscribe(ctx, c, start, end, fields)
+	defer close(r.done)
+	for v := range r.rows {
+		fn(v)
+	}
+	s.mu.Lock()
+	err, streamed, from, streamEnd := s.err, r.streamed, r.from, s.end
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to fetch data points: %w", err)
+	}
+
+	// the days of the window before and after the streamed responses
+	missed := [][2]time.Time{{start, end}}
+	if streamed {
+		missed = [][2]time.Time{
+			{start, minDate(from.AddDate(0, 0, -1), end)},
+			{maxDate(streamEnd.AddDate(0, 0, 1), start), end},
+		}
+	}
+	for _, w := range missed {
+		if date(w[0]) > date(w[1]) {
+			continue
+		}
+		c.Logger.Info().Str("type", s.exportType).Time("start", w[0]).Time("end", w[1]).Msg("exporting data points the shared export did not cover")
+		opts := simpleanalytics.ExportOptions{
+			Hostname: c.Website.Hostname,
+			Start:    w[0],
+			End:      w[1],
+			Fields:   fields,
+			Format:   c.Spec.Format,
+
+			OnFieldDrift: c.OnFieldDrift(s.exportType),
+			OnTransfer:   c.OnTransfer(s.exportType),
+		}
+		g, gctx := errgroup.WithContext(ctx)
+		var ch = make(chan T)
+		g.Go(func() error {
+			defer close(ch)
+			return exportDays(gctx, c, opts, s.export, ch)
+		})
+		for v := range ch {
+			fn(v)
+		}
+		if err := g.Wait(); err != nil {
+			return fmt.Errorf("failed to fetch data points: %w", err)
+		}
+	}
+	return nil
+}
+
+// subscribe adds a reader, and starts the export if it is the first one.
+func (s *sharedExport[T]) subscribe(ctx context.Context, c *client.Client, start, end time.Time, fields []string) *exportReader[T] {
+	r := &exportReader[T]{
+		c:      c,
+		start:  start,
+		end:    end,
+		fields: fields,
+		rows:   make(chan T, readerBufferSize),
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		close(r.rows)
+		return r
+	}
+	s.readers = append(s.readers, r)
+	if len(s.readers) == s.expected {
+		close(s.all)
+	}
+	if !s.started {
+		s.started = true
+		go s.run(ctx, c)
+	}
+	return r
+}
+
+// run streams the export to the readers, once all expected readers started or the grace period
+// is over.
+func (s *sharedExport[T]) run(ctx context.Context, c *client.Client) {
+	select {
+	case <-s.all:
+	case <-time.After(sharedExportGrace):
+	case <-ctx.Done():
+	}
+	opts := simpleanalytics.ExportOptions{
+		Hostname: c.Website.Hostname,
+		Format:   c.Spec.Format,
+
+		OnFieldDrift: c.OnFieldDrift(s.exportType),
+	}
+	s.mu.Lock()
+	s.fields = make(map[string]bool)
+	for i, r := range s.readers {
+		if i == 0 || r.start.Before(opts.Start) {
+			opts.Start = r.start
+		}
+		if i == 0 || r.end.After(opts.End) {
+			opts.End = r.end
+		}
+		for _, f := range r.fields {
+			if !s.fields[f] {
+				s.fields[f] = true
+				opts.Fields = append(opts.Fields, f)
+			}
+		}
+	}
+	s.end = opts.End
+	readers := len(s.readers)
+	s.mu.Unlock()
+	c.Logger.Info().Str("type", s.exportType).Int("tables", readers).Time("start", opts.Start).Time("end", opts.End).Msg("fetching data points shared by tables")
+
+	g, gctx := errgroup.WithContext(ctx)
+	var ch = make(chan exportRow[T])
+	g.Go(func() error {
+		defer close(ch)
+		return exportDays(gctx, c, opts, markResponses(s.export), ch)
+	})
+	var streamed []*exportReader[T]
+	var current time.Time
+	for row := range ch {
+		if streamed == nil || !row.start.Equal(current) {
+			current = row.start
+			streamed = s.join(current)
+		}
+		if row.stats != nil {
+			clients := make([]*client.Client, len(streamed))
+			for i, r := range streamed {
+				clients[i] = r.c
+			}
+			client.SplitTransfer(s.exportType, *row.stats, clients)
+			continue
+		}
+		// like the API, the dates of both start and end of a window are inclusive
+		day := date(s.added(row.v).UTC())
+		for _, r := range streamed {
+			if day < date(r.start) || day > date(r.end) {
+				continue
+			}
+			select {
+			case r.rows <- row.v:
+			case <-r.done:
+			}
+		}
+	}
+	err := g.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+	s.err = err
+	for _, r := range s.readers {
+		close(r.rows)
+	}
+}
+
+// join streams the responses from start on to the readers that started since the last response,
+// unless they need fields the export does not have, and returns all readers that are streamed to.
+func (s *sharedExport[T]) join(start time.Time) []*exportReader[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	streamed := make([]*exportReader[T], 0, len(s.readers))
+	for _, r := range s.readers {
+		if !r.streamed && s.hasFields(r.fields) {
+			r.streamed = true
+			r.from = start
+		}
+		if r.streamed {
+			streamed = append(streamed, r)
+		}
+	}
+	return streamed
+}
+
+func (s *sharedExport[T]) hasFields(fields []string) bool {
+	for _, f := range fields {
+		if !s.fields[f] {
+			return false
+		}
+	}
+	return true
+}
+
+func date(t time.Time) string {
+	return t.Format(client.AllowedTimeLayout)
+}
+
+func minDate(a, b time.Time) time.Time {
+	if date(b) < date(a) {
+		return b
+	}
+	return a
+}
+
+func maxDate(a, b time.Time) time.Time {
+	if date(b) > date(a) {
+		return b
+	}
+	return a
+}
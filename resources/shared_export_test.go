@@ -0,0 +1,171 @@
+package resources
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/specs"
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestSharedExportLateReader(t *testing.T) {
+	defer func(grace time.Duration) { sharedExportGrace = grace }(sharedExportGrace)
+	sharedExportGrace = 0
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	// The export returns a row per day, and holds back the days from the third on until the
+	// second reader started, so that it joins while the export is running.
+	var s *sharedExport[simpleanalytics.Event]
+	var mu sync.Mutex
+	windows := make(map[string]int)
+	export := func(ctx context.Context, opts simpleanalytics.ExportOptions, out chan<- simpleanalytics.Event) error {
+		mu.Lock()
+		windows[date(opts.Start)+".."+date(opts.End)]++
+		mu.Unlock()
+		for d := opts.Start; !d.After(opts.End); d = d.AddDate(0, 0, 1) {
+			for !d.Before(day(3)) {
+				s.mu.Lock()
+				n := len(s.readers)
+				s.mu.Unlock()
+				if n == 2 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			select {
+			case out <- simpleanalytics.Event{Datapoint: date(d), AddedISO: d.Add(12 * time.Hour)}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+	s = newSharedExport("events", export, func(v simpleanalytics.Event) time.Time { return v.AddedISO }, 2)
+	c := &client.Client{Spec: client.Spec{Concurrency: 2}}
+
+	var first, second []string
+	started := make(chan struct{})
+	g, ctx := errgroup.WithContext(context.Background())
+	g.Go(func() error {
+		return s.read(ctx, c, day(1), day(5), []string{"uuid"}, func(v simpleanalytics.Event) {
+			if first == nil {
+				close(started)
+			}
+			first = append(first, v.Datapoint)
+		})
+	})
+	<-started
+	g.Go(func() error {
+		return s.read(ctx, c, day(2), day(6), []string{"uuid"}, func(v simpleanalytics.Event) {
+			second = append(second, v.Datapoint)
+		})
+	})
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"2023-01-01", "2023-01-02", "2023-01-03", "2023-01-04", "2023-01-05"}, first); diff != "" {
+		t.Errorf("unexpected rows of the first reader. diff: %s", diff)
+	}
+	sort.Strings(second)
+	if diff := cmp.Diff([]string{"2023-01-02", "2023-01-03", "2023-01-04", "2023-01-05", "2023-01-06"}, second); diff != "" {
+		t.Errorf("unexpected rows of the late reader. diff: %s", diff)
+	}
+	// the days both readers got from the shared export are downloaded once
+	for _, w := range []string{"2023-01-04..2023-01-04", "2023-01-05..2023-01-05", "2023-01-06..2023-01-06"} {
+		if windows[w] != 1 {
+			t.Errorf("expected %s to be exported once, got %v", w, windows)
+		}
+	}
+}
+
+func TestSharedExportLowConcurrency(t *testing.T) {
+	defer func(grace time.Duration) { sharedExportGrace = grace }(sharedExportGrace)
+	sharedExportGrace = 50 * time.Millisecond
+	s := newTestServer(t)
+	for i, name := range []string{"signup", "login"} {
+		added := time.Date(2023, 1, 2+i, 12, 0, 0, 0, time.UTC)
+		s.AddEvents(simpleanalytics.Event{Hostname: "test.com", Datapoint: name, AddedISO: added, AddedUnix: uint64(added.Unix())})
+	}
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites[0].EventTables = []client.EventTableSpec{{Event: "signup"}, {Event: "login"}}
+
+	// With a single table slot, the first table cannot wait for the second one to start.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resources := client.TestSyncTablesContext(ctx, t, EventTables(spec), s.Server, spec, client.NewMemoryBackend(), func(src *specs.Source) {
+		src.Concurrency = 1
+	})
+	if ctx.Err() != nil {
+		t.Fatal("sync did not finish")
+	}
+	if len(resources) != 2 {
+		t.Errorf("expected a row for each event table, got %d", len(resources))
+	}
+}
+
+func TestSharedExportTransfer(t *testing.T) {
+	s := newTestServer(t)
+	for i, name := range []string{"signup", "login", "other"} {
+		added := time.Date(2023, 1, 2+i, 12, 0, 0, 0, time.UTC)
+		s.AddEvents(simpleanalytics.Event{Hostname: "test.com", Datapoint: name, AddedISO: added, AddedUnix: uint64(added.Unix())})
+	}
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites[0].EventTables = []client.EventTableSpec{{Event: "signup"}, {Event: "login"}}
+
+	tables := append(EventTables(spec), SyncRuns())
+	runs := syncRuns(t, client.TestSyncTables(t, tables, s.Server, spec, client.NewMemoryBackend()))
+	signup, login := runs[client.EventTableName("signup")], runs[client.EventTableName("login")]
+	if signup.WireBytes == 0 || login.WireBytes == 0 || signup.DecodedBytes == 0 || login.DecodedBytes == 0 {
+		t.Fatalf("expected the downloaded bytes to be split between the tables, got %+v and %+v", signup, login)
+	}
+	// the tables read the same responses, so their shares differ by at most the remainder
+	if d := signup.WireBytes - login.WireBytes; d < -1 || d > 1 {
+		t.Errorf("expected equal shares of the downloaded bytes, got %d and %d", signup.WireBytes, login.WireBytes)
+	}
+}
+
+func TestSharedExports(t *testing.T) {
+	s := newTestServer(t)
+	added := time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+	s.AddPageViews(simpleanalytics.PageView{Hostname: "test.com", SessionID: "a", Path: "/landing", AddedISO: added, AddedUnix: uint64(added.Unix())})
+	for i, name := range []string{"signup", "login", "other"} {
+		added := added.Add(time.Duration(i+1) * time.Minute)
+		s.AddEvents(simpleanalytics.Event{Hostname: "test.com", SessionID: "a", Datapoint: name, AddedISO: added, AddedUnix: uint64(added.Unix())})
+	}
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites[0].EventTables = []client.EventTableSpec{{Event: "login"}}
+	spec.Websites[0].ConversionEvents = []string{"signup"}
+
+	tables := append(EventTables(spec), PageViews(), Sessions(), Events(), Conversions())
+	counts := make(map[string]int)
+	for _, r := range client.TestSyncTables(t, tables, s.Server, spec, client.NewMemoryBackend()) {
+		counts[r.Table.Name]++
+		if conv, ok := r.Item.(*Conversion); ok && conv.LandingPath != "/landing" {
+			t.Errorf("expected the conversion to be attributed to its landing page, got %+v", conv)
+		}
+	}
+	want := map[string]int{
+		tablePageViews:                1,
+		tableSessions:                 1,
+		tableEvents:                   2,
+		tableConversions:              1,
+		client.EventTableName("login"): 1,
+	}
+	if diff := cmp.Diff(want, counts); diff != "" {
+		t.Errorf("unexpected rows per table. diff: %s", diff)
+	}
+	exports := make(map[string]int)
+	for _, r := range s.Requests() {
+		exports[r.Query["type"]]++
+	}
+	if diff := cmp.Diff(map[string]int{"pageviews": 1, "events": 1}, exports); diff != "" {
+		t.Errorf("expected a single export of each type. diff: %s", diff)
+	}
+}
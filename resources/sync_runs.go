@@ -0,0 +1,38 @@
+package resources
+
+import (
+	"context"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/transformers"
+)
+
+const tableSyncRuns = "simple_analytics_sync_runs"
+
+// SyncRuns must be the last table of the plugin, as its resolver waits for the resolvers of all
+// other tables to finish. See client.SyncRunsMultiplex for why this cannot block other tables.
+func SyncRuns() *schema.Table {
+	return &schema.Table{
+		Name:        tableSyncRuns,
+		Description: "Statistics of every table synced for every website in a sync: rows, bytes downloaded, synced window, cursor before and after, duration and errors. Rows are emitted once all other tables of the sync are done.",
+		Resolver:    fetchSyncRuns,
+		Multiplex:   client.SyncRunsMultiplex,
+		Transform: transformers.TransformWithStruct(
+			&client.SyncRun{},
+			transformers.WithPrimaryKeys("SyncStartedAt", "ClientID", "TableName"),
+		),
+	}
+}
+
+func fetchSyncRuns(ctx context.Context, meta schema.ClientMeta, parent *schema.Resource, res chan<- any) error {
+	c := meta.(*client.Client)
+	runs, err := c.WaitSyncRuns(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range runs {
+		res <- r
+	}
+	return nil
+}
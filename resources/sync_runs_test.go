@@ -0,0 +1,101 @@
+package resources
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/plugin-sdk/schema"
+	"github.com/cloudquery/plugin-sdk/specs"
+)
+
+func syncRuns(t *testing.T, resources []*schema.Resource) map[string]client.SyncRun {
+	t.Helper()
+	runs := make(map[string]client.SyncRun)
+	for _, r := range resources {
+		if run, ok := r.Item.(client.SyncRun); ok {
+			runs[run.TableName] = run
+		}
+	}
+	return runs
+}
+
+func TestSyncRuns(t *testing.T) {
+	s := newTestServer(t)
+	b := client.NewMemoryBackend()
+	addDailyPageViews(s, 1, 5)
+	tables := func() schema.Tables { return schema.Tables{PageViews(), Sessions(), SyncRuns()} }
+
+	runs := syncRuns(t, client.TestSyncTables(t, tables(), s.Server, incrementalSpec("2023-01-05"), b))
+	if len(runs) != 2 {
+		t.Fatalf("expected runs for 2 tables, got %v", runs)
+	}
+	pv := runs[tablePageViews]
+	if pv.Rows != 5 || pv.Errors != 0 {
+		t.Errorf("expected 5 rows and no errors, got %d rows and %d errors", pv.Rows, pv.Errors)
+	}
+	if pv.ClientID != "simple-analytics:test.com" || pv.Hostname != "test.com" {
+		t.Errorf("unexpected client %s and hostname %s", pv.ClientID, pv.Hostname)
+	}
+	if pv.WireBytes == 0 || pv.DecodedBytes == 0 {
+		t.Errorf("expected downloaded bytes to be counted, got %d on the wire and %d decoded", pv.WireBytes, pv.DecodedBytes)
+	}
+	if pv.WindowStart == nil || pv.WindowStart.Format("2006-01-02") != "2023-01-01" || pv.WindowEnd.Format("2006-01-02") != "2023-01-05" {
+		t.Errorf("unexpected window %v - %v", pv.WindowStart, pv.WindowEnd)
+	}
+	if cur, err := client.ParseCursor(pv.CursorAfter); pv.CursorBefore != "" || err != nil || cur.Next != "2023-01-04" {
+		t.Errorf("unexpected cursors before %q and after %q", pv.CursorBefore, pv.CursorAfter)
+	}
+	if pv.FinishedAt.Before(pv.StartedAt) || pv.SyncStartedAt.IsZero() {
+		t.Errorf("unexpected times: sync started at %v, run from %v to %v", pv.SyncStartedAt, pv.StartedAt, pv.FinishedAt)
+	}
+	if runs[tableSessions].Rows != 0 {
+		t.Errorf("expected no sessions for page views without session IDs, got %d", runs[tableSessions].Rows)
+	}
+
+	// A failed run is recorded with its error, and keeps its cursor.
+	s.InjectError(http.StatusInternalServerError, "boom")
+	next := syncRuns(t, client.TestSyncTables(t, schema.Tables{PageViews(), SyncRuns()}, s.Server, incrementalSpec("2023-01-06"), b))[tablePageViews]
+	if next.Errors != 1 || next.Error == "" {
+		t.Errorf("expected the run to have failed, got %d errors: %q", next.Errors, next.Error)
+	}
+	if next.CursorBefore != pv.CursorAfter || next.CursorAfter != pv.CursorAfter {
+		t.Errorf("expected the cursor to be kept, got before %q and after %q", next.CursorBefore, next.CursorAfter)
+	}
+	if next.WindowStart != nil {
+		t.Errorf("expected no window for a failed run, got %v", next.WindowStart)
+	}
+}
+
+func TestSyncRunsRoundRobin(t *testing.T) {
+	// with a single table slot, the shared page views export never gets its second table in time
+	defer func(grace time.Duration) { sharedExportGrace = grace }(sharedExportGrace)
+	sharedExportGrace = 50 * time.Millisecond
+	s := newTestServer(t)
+	addDailyPageViews(s, 1, 5)
+	spec := incrementalSpec("2023-01-05")
+	spec.Websites = append(spec.Websites, client.WebsiteSpec{Hostname: "b.com"}, client.WebsiteSpec{Hostname: "c.com"})
+	tables := schema.Tables{PageViews(), Sessions(), SyncRuns()}
+
+	// With a single table slot, the sync runs table must not take it before the other tables got theirs.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resources := client.TestSyncTablesContext(ctx, t, tables, s.Server, spec, client.NewMemoryBackend(), func(src *specs.Source) {
+		src.Scheduler = specs.SchedulerRoundRobin
+		src.Concurrency = 1
+	})
+	if ctx.Err() != nil {
+		t.Fatal("sync did not finish")
+	}
+	counts := make(map[string]int)
+	for _, r := range resources {
+		if run, ok := r.Item.(client.SyncRun); ok {
+			counts[run.TableName]++
+		}
+	}
+	if counts[tablePageViews] != 3 || counts[tableSessions] != 3 {
+		t.Errorf("expected a run per website for each table, got %v", counts)
+	}
+}
@@ -0,0 +1,57 @@
+package resources
+
+import (
+	"context"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/useragent"
+	"github.com/cloudquery/plugin-sdk/schema"
+)
+
+// userAgentColumns are populated by resolveUserAgent if parse_user_agent is enabled.
+var userAgentColumns = []schema.Column{
+	{Name: "ua_engine", Type: schema.TypeString, Resolver: noopResolver},
+	{Name: "ua_device_brand", Type: schema.TypeString, Resolver: noopResolver},
+	{Name: "ua_device_model", Type: schema.TypeString, Resolver: noopResolver},
+	{Name: "ua_is_webview", Type: schema.TypeBool, Resolver: noopResolver},
+}
+
+// noopResolver stops the SDK from looking up a struct field with the column's name.
+func noopResolver(context.Context, schema.ClientMeta, *schema.Resource, schema.Column) error {
+	return nil
+}
+
+// resolveUserAgent parses the user agent of the row once and sets all ua_* columns.
+// Values that could not be determined are left empty, and so are all columns of rows without a
+// user agent.
+func resolveUserAgent(_ context.Context, meta schema.ClientMeta, r *schema.Resource) error {
+	c := meta.(*client.Client)
+	if !c.Spec.ParseUserAgent {
+		return nil
+	}
+	var ua string
+	switch item := r.Item.(type) {
+	case simpleanalytics.PageView:
+		ua = item.UserAgent
+	case simpleanalytics.Event:
+		ua = item.UserAgent
+	}
+	if ua == "" {
+		return nil
+	}
+	info := useragent.Parse(ua)
+	for col, v := range map[string]string{
+		"ua_engine":       info.Engine,
+		"ua_device_brand": info.DeviceBrand,
+		"ua_device_model": info.DeviceModel,
+	} {
+		if v == "" {
+			continue
+		}
+		if err := r.Set(col, v); err != nil {
+			return err
+		}
+	}
+	return r.Set("ua_is_webview", info.IsWebview)
+}
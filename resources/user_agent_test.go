@@ -0,0 +1,36 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudquery/cq-source-simple-analytics/client"
+	"github.com/cloudquery/cq-source-simple-analytics/internal/simpleanalytics"
+	"github.com/cloudquery/plugin-sdk/schema"
+)
+
+func TestResolveUserAgent(t *testing.T) {
+	c := &client.Client{Spec: client.Spec{ParseUserAgent: true}}
+	tests := []struct {
+		userAgent string
+		wantNull  bool
+	}{
+		{userAgent: testUserAgent},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:108.0) Gecko/20100101 Firefox/108.0"},
+		{userAgent: "", wantNull: true},
+	}
+	for _, tc := range tests {
+		r := schema.NewResourceData(PageViews(), nil, simpleanalytics.PageView{UserAgent: tc.userAgent})
+		if err := resolveUserAgent(context.Background(), c, r); err != nil {
+			t.Fatal(err)
+		}
+		for _, col := range userAgentColumns {
+			v := r.Get(col.Name)
+			if isNull := v == nil || v.GetStatus() != schema.Present; col.Name == "ua_is_webview" && isNull != tc.wantNull {
+				t.Errorf("user agent %q: unexpected ua_is_webview. got: %v, want null: %v", tc.userAgent, v, tc.wantNull)
+			} else if tc.wantNull && !isNull {
+				t.Errorf("user agent %q: expected %s to be null, got: %v", tc.userAgent, col.Name, v)
+			}
+		}
+	}
+}